@@ -2,7 +2,9 @@ package main
 
 import (
 	"fmt"
+	"io/ioutil"
 	"log"
+	"os"
 	"time"
 
 	"github.com/urfave/cli/v2"
@@ -19,7 +21,31 @@ type args struct {
 	Daemon   bool
 	Interval int
 	NoPrompt bool
-	Archive  string
+	Archives []string
+
+	// Write matched tweets to a plan file instead of deleting them
+	DryRun bool
+	Plan   string
+
+	// Write all matched tweets to this file (CSV or JSON) before deleting them
+	Export string
+
+	// Path to the journal of deleted tweets, used to resume interrupted runs
+	JournalPath string
+	Journal     *histweet.Journal
+
+	// Maximum number of tweets to delete in parallel
+	Concurrency int
+
+	// Show why each tweet matched the rule(s)
+	Explain bool
+
+	// Context that rules are evaluated in. The account is looked up on each
+	// run if the rule needs it, and the time defaults to the start of the run.
+	Context histweet.EvalContext
+
+	// Renders the results of each run
+	Output output
 
 	// Twitter API key
 	ConsumerKey    string
@@ -31,51 +57,202 @@ type args struct {
 	Rule histweet.Rule
 }
 
-func runSingle(args *args, client *histweet.TwitterClient) error {
+// Builds the context to evaluate rules in for a single run
+func evalContext(args *args, client *histweet.TwitterClient) (*histweet.EvalContext, error) {
+	ctx := args.Context
+
+	if ctx.Now.IsZero() {
+		ctx.Now = time.Now()
+	}
+
+	if !args.Rule.NeedsAccount() {
+		return &ctx, nil
+	}
+
+	account, err := histweet.FetchAccount(client)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx.Account = account
+
+	return &ctx, nil
+}
+
+// Fetches all tweets that match the rule, from either the timeline or the
+// provided archive(s)
+func fetchTweets(args *args, client *histweet.TwitterClient, ctx *histweet.EvalContext) ([]histweet.Tweet, error) {
 	var tweets []histweet.Tweet
 	var err error
 
-	if args.Archive == "" {
+	progress := newProgressRenderer(os.Stderr, 0)
+	fetchOpts := &histweet.FetchOptions{Observer: progress, Context: ctx}
+
+	if len(args.Archives) == 0 {
 		// Fetch tweets based on provided rules
 		// For now, we assume that user wants to use the timeline API
-		tweets, err = histweet.FetchTimelineTweets(&args.Rule, client)
+		tweets, err = histweet.FetchTimelineTweets(&args.Rule, client, fetchOpts)
+	} else {
+		tweets, err = histweet.FetchArchiveTweets(&args.Rule, fetchOpts, args.Archives...)
+	}
+
+	progress.Finish()
+
+	return tweets, err
+}
+
+func runSingle(args *args, client *histweet.TwitterClient) (err error) {
+	var tweets []histweet.Tweet
+
+	out := args.Output
+	defer func() {
+		if flushErr := out.flush(); err == nil {
+			err = flushErr
+		}
+	}()
+
+	ctx, err := evalContext(args, client)
+	if err != nil {
+		return err
+	}
+
+	tweets, err = fetchTweets(args, client, ctx)
+	if err != nil {
+		return err
+	}
+
+	// Skip all tweets that were deleted by a previous (interrupted) run
+	tweets, skipped := skipJournaled(tweets, args.Journal)
+
+	numTweets := len(tweets)
+
+	if numTweets == 0 {
+		out.info("\nNo tweets to delete that match the given rule(s).\n")
+
+		// Replace any plan left over from a previous run, so that it cannot
+		// be applied by mistake
+		err = writePlan(args, tweets, out)
 		if err != nil {
 			return err
 		}
-	} else {
-		tweets, err = histweet.FetchArchiveTweets(args.Rule.Tweet, args.Archive)
+
+		out.summary(&summaryRecord{Matched: skipped, Skipped: skipped, DryRun: args.DryRun, Plan: args.Plan}, nil)
+		return nil
+	}
+
+	out.matched(tweets, explainRule(args), ctx)
+
+	// Keep a copy of the matched tweets before anything is deleted
+	if args.Export != "" {
+		err = histweet.ExportTweets(tweets, args.Export)
 		if err != nil {
 			return err
 		}
+
+		out.info("\nExported %d tweets to %s\n", numTweets, args.Export)
 	}
 
-	numTweets := len(tweets)
+	err = writePlan(args, tweets, out)
+	if err != nil {
+		return err
+	}
 
-	if numTweets == 0 {
-		fmt.Println("\nNo tweets to delete that match the given rule(s).")
+	if args.DryRun {
+		out.summary(&summaryRecord{Matched: numTweets + skipped, Skipped: skipped, DryRun: true, Plan: args.Plan}, nil)
+		return nil
+	}
+
+	opts := &histweet.DeleteOptions{
+		Journal:     args.Journal,
+		Concurrency: args.Concurrency,
+	}
+
+	err = deleteTweets(tweets, skipped, args.NoPrompt || args.Daemon, opts, client, out)
+
+	// Failed tweets are listed in the summary and retried in the next run, so
+	// they should not stop the daemon
+	if err != nil && args.Daemon {
+		log.Printf("%s, retrying in the next run", err)
+		return nil
+	}
+
+	return err
+}
+
+// Writes a plan to delete the given tweets, if a plan file was requested
+func writePlan(args *args, tweets []histweet.Tweet, out output) error {
+	if args.Plan == "" {
+		return nil
+	}
+
+	plan := histweet.NewPlan(&args.Rule, tweets)
+
+	err := plan.Write(args.Plan)
+	if err != nil {
+		return err
+	}
+
+	out.info("\nWrote a plan to delete %d tweets to %s\n", len(tweets), args.Plan)
+
+	return nil
+}
+
+// Returns the rule to explain matched tweets with, or nil if explanations
+// were not requested
+func explainRule(args *args) *histweet.Rule {
+	if !args.Explain {
 		return nil
 	}
 
+	return &args.Rule
+}
+
+// Returns all tweets that are not in the given journal (if any), and the
+// number of tweets that were skipped
+func skipJournaled(tweets []histweet.Tweet, journal *histweet.Journal) ([]histweet.Tweet, int) {
+	if journal == nil {
+		return tweets, 0
+	}
+
+	remaining := journal.Remaining(tweets)
+
+	return remaining, len(tweets) - len(remaining)
+}
+
+// Deletes the given tweets, after asking the user to confirm (unless noPrompt
+// is set). Skipped is the number of matched tweets that were already filtered
+// out by the journal, which is included in the summary.
+func deleteTweets(tweets []histweet.Tweet, skipped int, noPrompt bool, opts *histweet.DeleteOptions, client *histweet.TwitterClient, out output) error {
+	numTweets := len(tweets)
+
 	// Wait for user to confirm
-	if !args.NoPrompt && !args.Daemon {
-		fmt.Printf("\nDelete %d tweets that match the above? [y/n] ", numTweets)
+	if !noPrompt {
+		fmt.Fprintf(out.prompt(), "\nDelete %d tweets that match the above? [y/n] ", numTweets)
 
 		var input string
 		fmt.Scanf("%s", &input)
 		if input != "y" {
-			fmt.Println("Aborting...")
+			fmt.Fprintln(out.prompt(), "Aborting...")
+			out.summary(&summaryRecord{Matched: numTweets + skipped, Skipped: skipped, Aborted: true}, nil)
 			return nil
 		}
 	}
 
-	err = histweet.DeleteTweets(tweets, client)
-	if err != nil {
-		return err
-	}
+	progress := newProgressRenderer(os.Stderr, numTweets)
+	opts.Observer = multiObserver{progress, out}
 
-	log.Printf("Deleted %d tweets!", numTweets)
+	result, err := histweet.DeleteTweets(tweets, client, opts)
 
-	return nil
+	progress.Finish()
+
+	out.summary(&summaryRecord{
+		Matched: numTweets + skipped,
+		Deleted: result.Deleted,
+		Skipped: skipped + result.Skipped,
+		Failed:  len(result.Failed),
+	}, result.Failed)
+
+	return err
 }
 
 // Run the CLI in daemon mode
@@ -89,7 +266,7 @@ func runDaemon(args *args, client *histweet.TwitterClient) error {
 
 	ticker := time.NewTicker(interval * time.Second)
 
-	fmt.Printf("\nRunning in daemon mode (interval = %ds)...\n", interval)
+	args.Output.info("\nRunning in daemon mode (interval = %ds)...\n", interval)
 
 	for {
 		select {
@@ -104,17 +281,7 @@ func runDaemon(args *args, client *histweet.TwitterClient) error {
 }
 
 func run(args *args) error {
-	fmt.Println("\nRules")
-	fmt.Println("=====")
-
-	// TODO: Print summary of provided rules
-	if args.Rule.Tweet != nil {
-		fmt.Printf("  * Rule: %s", args.Rule.Input)
-	}
-
-	if args.Rule.Count != nil {
-		fmt.Printf("  * Rule: keep only the latest %d tweets", args.Rule.Count.N)
-	}
+	args.Output.rules(args.Rule.Describe())
 
 	client, err := histweet.NewTwitterClient(args.ConsumerKey,
 		args.ConsumerSecret,
@@ -125,6 +292,14 @@ func run(args *args) error {
 		return err
 	}
 
+	if args.JournalPath != "" {
+		args.Journal, err = histweet.OpenJournal(args.JournalPath)
+		if err != nil {
+			return err
+		}
+		defer args.Journal.Close()
+	}
+
 	if args.Daemon {
 		return runDaemon(args, client)
 	}
@@ -132,43 +307,39 @@ func run(args *args) error {
 	return runSingle(args, client)
 }
 
-// Handles the CLI arguments and calls into the histweet lib to run the command
-func handleCli(c *cli.Context) error {
+// Parses the rule(s) provided on the command line: either a count, a rule
+// string, or a rules file
+func parseRule(c *cli.Context) (*histweet.Rule, error) {
 	count := c.Int("count")
-	archive := c.String("archive")
-	noPrompt := c.Bool("no-prompt")
-	daemon := c.Bool("daemon")
-	interval := c.Int("interval")
+	rulesFile := c.String("rules-file")
 
 	var inputRule string
 
-	isRuleProvided := false
-
-	if !c.IsSet("consumer-key") || !c.IsSet("consumer-secret") ||
-		!c.IsSet("access-token") || !c.IsSet("access-secret") {
-		return cli.Exit("All Twitter API keys are required", 1)
-	}
-
-	// Twitter API info
-	consumerKey := c.String("consumer-key")
-	consumerSecret := c.String("consumer-secret")
-	accessToken := c.String("access-token")
-	accessSecret := c.String("access-secret")
-
 	// Pointer to each of the available rule types
 	var ruleCount *histweet.RuleCount
 	var ruleTweet *histweet.ParsedRule
+	var ruleNamed []*histweet.NamedRule
 
 	if c.Command.HasName("count") {
 		// Count-based rule
 		ruleCount = &histweet.RuleCount{
 			N: count,
 		}
+	} else if rulesFile != "" {
+		if c.Args().Len() > 0 {
+			return nil, cli.Exit("Please specify either a rule string or a rules file, not both!", 1)
+		}
+
+		// Parse all named rules in the provided file
+		res, err := histweet.ParseRulesFile(rulesFile)
+		if err != nil {
+			return nil, err
+		}
 
-		isRuleProvided = true
-	} else if c.Command.HasName("rule") {
+		ruleNamed = res
+	} else {
 		if c.Args().Len() == 0 {
-			return cli.Exit("Please specify a rule string!", 1)
+			return nil, cli.Exit("Please specify a rule string or a rules file!", 1)
 		}
 
 		inputRule = c.Args().Get(0)
@@ -178,44 +349,317 @@ func handleCli(c *cli.Context) error {
 		// Parse the provided tweet-based rule
 		res, err := parser.Parse()
 		if err != nil {
-			return err
+			return nil, err
 		}
 
 		ruleTweet = res
-
-		isRuleProvided = true
-	}
-
-	// If no rules were provided, let's bail out here
-	if !isRuleProvided {
-		return cli.Exit("No rules provided... aborting", 1)
 	}
 
 	// Build the combined rule
-	rule := histweet.Rule{
+	rule := &histweet.Rule{
 		Tweet: ruleTweet,
+		Named: ruleNamed,
 		Count: ruleCount,
 		Input: inputRule,
 	}
 
+	return rule, nil
+}
+
+// Parses the time zone and time to evaluate rules at from the command line
+func parseEvalContext(c *cli.Context) (*histweet.EvalContext, error) {
+	location, err := time.LoadLocation(c.String("timezone"))
+	if err != nil {
+		return nil, cli.Exit(fmt.Sprintf("Invalid time zone: %s", c.String("timezone")), 1)
+	}
+
+	ctx := &histweet.EvalContext{Location: location}
+
+	if now := c.String("now"); now != "" {
+		ctx.Now, err = time.ParseInLocation("2006-01-02", now, location)
+		if err != nil {
+			ctx.Now, err = time.Parse(time.RFC3339, now)
+		}
+
+		if err != nil {
+			return nil, cli.Exit(fmt.Sprintf("Invalid time: %s", now), 1)
+		}
+	}
+
+	return ctx, nil
+}
+
+// Handles the CLI arguments and calls into the histweet lib to run the command
+func handleCli(c *cli.Context) error {
+	archives := c.StringSlice("archive")
+	noPrompt := c.Bool("no-prompt")
+	daemon := c.Bool("daemon")
+	interval := c.Int("interval")
+	export := c.String("export")
+	dryRun := c.Bool("dry-run")
+	plan := c.String("plan")
+	journal := c.String("journal")
+	concurrency := c.Int("concurrency")
+
+	out, err := newOutput(c.String("output"), os.Stdout)
+	if err != nil {
+		return cli.Exit(err.Error(), 1)
+	}
+
+	if dryRun && plan == "" {
+		return cli.Exit("A dry run requires a plan file (--plan)", 1)
+	}
+
+	if dryRun && daemon {
+		return cli.Exit("A dry run cannot be combined with daemon mode", 1)
+	}
+
+	// Each run would overwrite the tweets exported by the previous one
+	if export != "" && daemon {
+		return cli.Exit("An export cannot be combined with daemon mode", 1)
+	}
+
+	if export != "" {
+		_, err = histweet.ExportFormat(export)
+		if err != nil {
+			return cli.Exit(err.Error(), 1)
+		}
+	}
+
+	if !c.IsSet("consumer-key") || !c.IsSet("consumer-secret") ||
+		!c.IsSet("access-token") || !c.IsSet("access-secret") {
+		return cli.Exit("All Twitter API keys are required", 1)
+	}
+
+	rule, err := parseRule(c)
+	if err != nil {
+		return err
+	}
+
+	ctx, err := parseEvalContext(c)
+	if err != nil {
+		return err
+	}
+
+	// Evaluating each run at the same time would match the same tweets
+	if daemon && !ctx.Now.IsZero() {
+		return cli.Exit("A fixed time (--now) cannot be combined with daemon mode", 1)
+	}
+
 	// Build the args struct to run the command
 	args := &args{
 		Daemon:         daemon,
 		Interval:       interval,
 		NoPrompt:       noPrompt,
-		Archive:        archive,
-		ConsumerKey:    consumerKey,
-		ConsumerSecret: consumerSecret,
-		AccessToken:    accessToken,
-		AccessSecret:   accessSecret,
-		Rule:           rule,
+		Archives:       archives,
+		DryRun:         dryRun,
+		Plan:           plan,
+		JournalPath:    journal,
+		Export:         export,
+		Concurrency:    concurrency,
+		Explain:        c.Bool("explain"),
+		Context:        *ctx,
+		Output:         out,
+		ConsumerKey:    c.String("consumer-key"),
+		ConsumerSecret: c.String("consumer-secret"),
+		AccessToken:    c.String("access-token"),
+		AccessSecret:   c.String("access-secret"),
+		Rule:           *rule,
 	}
 
 	// Run the command!
-	err := run(args)
+	err = run(args)
 	if err != nil {
 		return err
 	}
 
 	return nil
 }
+
+// Handles the "apply" command, which deletes all tweets in a plan file
+func handleApply(c *cli.Context) error {
+	if c.Args().Len() == 0 {
+		return cli.Exit("Please specify a plan file!", 1)
+	}
+
+	out, err := newOutput(c.String("output"), os.Stdout)
+	if err != nil {
+		return cli.Exit(err.Error(), 1)
+	}
+
+	plan, err := histweet.ReadPlan(c.Args().Get(0))
+	if err != nil {
+		return err
+	}
+
+	out.info("\nPlan created at %s\n", plan.CreatedAt.Format(time.RFC1123))
+	out.rules(plan.Rules)
+
+	if len(plan.Tweets) == 0 {
+		out.info("\nNo tweets to delete in the given plan.\n")
+		out.summary(&summaryRecord{}, nil)
+		return out.flush()
+	}
+
+	client, err := histweet.NewTwitterClient(c.String("consumer-key"),
+		c.String("consumer-secret"),
+		c.String("access-token"),
+		c.String("access-secret"),
+		true)
+	if err != nil {
+		return err
+	}
+
+	tweets := plan.ToTweets()
+
+	var journal *histweet.Journal
+
+	if c.IsSet("journal") {
+		journal, err = histweet.OpenJournal(c.String("journal"))
+		if err != nil {
+			return err
+		}
+		defer journal.Close()
+	}
+
+	tweets, skipped := skipJournaled(tweets, journal)
+
+	if len(tweets) == 0 {
+		out.info("\nAll tweets in the given plan were already deleted.\n")
+		out.summary(&summaryRecord{Matched: skipped, Skipped: skipped}, nil)
+		return out.flush()
+	}
+
+	out.matched(tweets, nil, nil)
+
+	opts := &histweet.DeleteOptions{
+		Journal:     journal,
+		Concurrency: c.Int("concurrency"),
+	}
+
+	err = deleteTweets(tweets, skipped, c.Bool("no-prompt"), opts, client, out)
+
+	if flushErr := out.flush(); err == nil {
+		err = flushErr
+	}
+
+	return err
+}
+
+// Handles the "export" command, which writes all tweets that match a rule to
+// a file without deleting anything
+func handleExport(c *cli.Context) error {
+	path := c.String("file")
+
+	_, err := histweet.ExportFormat(path)
+	if err != nil {
+		return cli.Exit(err.Error(), 1)
+	}
+
+	out, err := newOutput(c.String("output"), os.Stdout)
+	if err != nil {
+		return cli.Exit(err.Error(), 1)
+	}
+
+	rule, err := parseRule(c)
+	if err != nil {
+		return err
+	}
+
+	baseCtx, err := parseEvalContext(c)
+	if err != nil {
+		return err
+	}
+
+	args := &args{
+		Archives: c.StringSlice("archive"),
+		Explain:  c.Bool("explain"),
+		Context:  *baseCtx,
+		Rule:     *rule,
+	}
+
+	// The API is only needed to read the timeline or to look up the account,
+	// so an export from an archive works offline and without API keys
+	var client *histweet.TwitterClient
+
+	if len(args.Archives) == 0 || rule.NeedsAccount() {
+		if !c.IsSet("consumer-key") || !c.IsSet("consumer-secret") ||
+			!c.IsSet("access-token") || !c.IsSet("access-secret") {
+			return cli.Exit("All Twitter API keys are required to read the timeline or to look up the account", 1)
+		}
+
+		client, err = histweet.NewTwitterClient(c.String("consumer-key"),
+			c.String("consumer-secret"),
+			c.String("access-token"),
+			c.String("access-secret"),
+			true)
+		if err != nil {
+			return err
+		}
+	}
+
+	out.rules(rule.Describe())
+
+	ctx, err := evalContext(args, client)
+	if err != nil {
+		return err
+	}
+
+	tweets, err := fetchTweets(args, client, ctx)
+	if err != nil {
+		return err
+	}
+
+	out.matched(tweets, explainRule(args), ctx)
+
+	err = histweet.ExportTweets(tweets, path)
+	if err != nil {
+		return err
+	}
+
+	out.info("\nExported %d tweets to %s\n", len(tweets), path)
+
+	return out.flush()
+}
+
+// Handles the "fmt" command, which prints a rule string or rules file in its
+// canonical format
+func handleFmt(c *cli.Context) error {
+	rulesFile := c.String("rules-file")
+
+	if rulesFile == "" {
+		if c.Args().Len() == 0 {
+			return cli.Exit("Please specify a rule string or a rules file!", 1)
+		}
+
+		rule, err := histweet.Parse(c.Args().Get(0))
+		if err != nil {
+			return err
+		}
+
+		fmt.Println(histweet.Format(rule))
+
+		return nil
+	}
+
+	if c.Args().Len() > 0 {
+		return cli.Exit("Please specify either a rule string or a rules file, not both!", 1)
+	}
+
+	buf, err := ioutil.ReadFile(rulesFile)
+	if err != nil {
+		return err
+	}
+
+	formatted, err := histweet.FormatRules(string(buf))
+	if err != nil {
+		return err
+	}
+
+	if !c.Bool("write") {
+		fmt.Print(formatted)
+		return nil
+	}
+
+	return ioutil.WriteFile(rulesFile, []byte(formatted), 0644)
+}
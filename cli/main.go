@@ -8,38 +8,69 @@ import (
 	"github.com/urfave/cli/v2"
 )
 
-func buildCliApp() *cli.App {
-	// Define CLI flags
-	countFlags := []cli.Flag{
-		&cli.IntFlag{
-			Name:    "count",
-			Aliases: []string{"n"},
-			Usage:   "Only keep the `N` most recent tweets (all other rules are ignored!)",
-		},
+// Flags for the Twitter API keys. They are required by all commands, except
+// for commands that may not need the API (e.g., an export from an archive).
+func credentialFlags(required bool) []cli.Flag {
+	return []cli.Flag{
 		&cli.StringFlag{
 			Name:     "consumer-key",
 			Usage:    "Twitter API consumer `key`",
 			EnvVars:  []string{"HISTWEET_CONSUMER_KEY"},
-			Required: true,
+			Required: required,
 		},
 		&cli.StringFlag{
 			Name:     "consumer-secret",
 			Usage:    "Twitter API consumer secret `key`",
 			EnvVars:  []string{"HISTWEET_CONSUMER_SECRET"},
-			Required: true,
+			Required: required,
 		},
 		&cli.StringFlag{
 			Name:     "access-token",
 			Usage:    "Twitter API access `token`",
 			EnvVars:  []string{"HISTWEET_ACCESS_TOKEN"},
-			Required: true,
+			Required: required,
 		},
 		&cli.StringFlag{
 			Name:     "access-secret",
 			Usage:    "Twitter API access secret `token`",
 			EnvVars:  []string{"HISTWEET_ACCESS_SECRET"},
-			Required: true,
+			Required: required,
+		},
+	}
+}
+
+// Flags for the source of tweets and the rules to match them against
+func ruleFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringSliceFlag{
+			Name:        "archive",
+			Usage:       "Path to tweet archive `file` (tweet.js), directory, or ZIP - repeat for multi-part archives",
+			DefaultText: "Timeline API lookup",
+		},
+		&cli.StringFlag{
+			Name:  "rules-file",
+			Usage: "Load named rules from `file` instead of the command line",
 		},
+		&cli.BoolFlag{
+			Name:  "explain",
+			Usage: "Show why each matched tweet matched the rule(s)",
+		},
+		&cli.StringFlag{
+			Name:  "timezone",
+			Value: "UTC",
+			Usage: "Time `zone` used for dates without one, e.g. \"America/New_York\" or \"Local\"",
+		},
+		&cli.StringFlag{
+			Name:        "now",
+			Usage:       "Evaluate the rule(s) as if it were this `time` (a date or RFC 3339 datetime), e.g. to preview what a rule would match in the future",
+			DefaultText: "current time",
+		},
+	}
+}
+
+// Flags shared by all commands that find and delete tweets
+func deleteFlags() []cli.Flag {
+	return []cli.Flag{
 		&cli.BoolFlag{
 			Name:  "no-prompt",
 			Value: false,
@@ -57,54 +88,101 @@ func buildCliApp() *cli.App {
 			Value:   minDaemonInterval,
 			Usage:   "Interval at which to check for tweets, in `seconds`",
 		},
-	}
-
-	tweetFlags := []cli.Flag{
-		&cli.StringFlag{
-			Name:        "archive",
-			Usage:       "Path to tweet archive `file` (tweet.js)",
-			DefaultText: "Timeline API lookup",
+		&cli.BoolFlag{
+			Name:  "dry-run",
+			Value: false,
+			Usage: "Do not delete any tweets - requires --plan",
 		},
 		&cli.StringFlag{
-			Name:     "consumer-key",
-			Usage:    "Twitter API consumer `key`",
-			EnvVars:  []string{"HISTWEET_CONSUMER_KEY"},
-			Required: true,
+			Name:  "plan",
+			Usage: "Write all matched tweets to a plan `file` that can be reviewed and applied later",
 		},
 		&cli.StringFlag{
-			Name:     "consumer-secret",
-			Usage:    "Twitter API consumer secret `key`",
-			EnvVars:  []string{"HISTWEET_CONSUMER_SECRET"},
-			Required: true,
+			Name:  "export",
+			Usage: "Write all matched tweets to a CSV or JSON `file` before deleting them",
 		},
-		&cli.StringFlag{
-			Name:     "access-token",
-			Usage:    "Twitter API access `token`",
-			EnvVars:  []string{"HISTWEET_ACCESS_TOKEN"},
-			Required: true,
+		journalFlag(),
+		concurrencyFlag(),
+		outputFlag(),
+	}
+}
+
+// Flag for the journal used to resume interrupted deletions
+func journalFlag() cli.Flag {
+	return &cli.StringFlag{
+		Name:  "journal",
+		Usage: "Record deleted tweets in a journal `file` and skip tweets already in it, to safely resume interrupted runs",
+	}
+}
+
+// Flag for the number of tweets to delete in parallel
+func concurrencyFlag() cli.Flag {
+	return &cli.IntFlag{
+		Name:  "concurrency",
+		Value: 1,
+		Usage: "Maximum number of tweets to delete in parallel",
+	}
+}
+
+// Flag for the output format of all commands
+func outputFlag() cli.Flag {
+	return &cli.StringFlag{
+		Name:    "output",
+		Aliases: []string{"o"},
+		Value:   outputText,
+		Usage:   "Output `format`: text, json (a single document), or ndjson (one record per line)",
+	}
+}
+
+func buildCliApp() *cli.App {
+	// Define CLI flags
+	countFlags := []cli.Flag{
+		&cli.IntFlag{
+			Name:    "count",
+			Aliases: []string{"n"},
+			Usage:   "Only keep the `N` most recent tweets (all other rules are ignored!)",
 		},
+	}
+	countFlags = append(countFlags, credentialFlags(true)...)
+	countFlags = append(countFlags, deleteFlags()...)
+
+	tweetFlags := ruleFlags()
+	tweetFlags = append(tweetFlags, credentialFlags(true)...)
+	tweetFlags = append(tweetFlags, deleteFlags()...)
+
+	exportFlags := []cli.Flag{
 		&cli.StringFlag{
-			Name:     "access-secret",
-			Usage:    "Twitter API access secret `token`",
-			EnvVars:  []string{"HISTWEET_ACCESS_SECRET"},
+			Name:     "file",
+			Aliases:  []string{"f"},
+			Usage:    "Write all matched tweets to this CSV or JSON `file`",
 			Required: true,
 		},
+		outputFlag(),
+	}
+	exportFlags = append(exportFlags, ruleFlags()...)
+	exportFlags = append(exportFlags, credentialFlags(false)...)
+
+	applyFlags := []cli.Flag{
 		&cli.BoolFlag{
 			Name:  "no-prompt",
 			Value: false,
-			Usage: "Do not prompt user to confirm deletion - ignored in daemon mode",
+			Usage: "Do not prompt user to confirm deletion",
 		},
-		&cli.BoolFlag{
-			Name:    "daemon",
-			Aliases: []string{"d"},
-			Value:   false,
-			Usage:   "Run the CLI in daemon mode",
+		journalFlag(),
+		concurrencyFlag(),
+		outputFlag(),
+	}
+	applyFlags = append(applyFlags, credentialFlags(true)...)
+
+	fmtFlags := []cli.Flag{
+		&cli.StringFlag{
+			Name:  "rules-file",
+			Usage: "Format the rules in `file` instead of a rule string",
 		},
-		&cli.IntFlag{
-			Name:    "interval",
-			Aliases: []string{"i"},
-			Value:   minDaemonInterval,
-			Usage:   "Interval at which to check for tweets, in `seconds`",
+		&cli.BoolFlag{
+			Name:    "write",
+			Aliases: []string{"w"},
+			Usage:   "Write the formatted rules back to the rules file",
 		},
 	}
 
@@ -133,6 +211,27 @@ func buildCliApp() *cli.App {
 				Aliases: []string{"r"},
 				Action:  handleCli,
 			},
+			{
+				Name:      "apply",
+				Flags:     applyFlags,
+				Usage:     "Delete all tweets in a reviewed plan file",
+				ArgsUsage: "PLAN",
+				Action:    handleApply,
+			},
+			{
+				Name:      "export",
+				Flags:     exportFlags,
+				Usage:     "Write all tweets that match a rule to a CSV or JSON file, without deleting them",
+				ArgsUsage: "[RULE]",
+				Action:    handleExport,
+			},
+			{
+				Name:      "fmt",
+				Flags:     fmtFlags,
+				Usage:     "Print a rule string or rules file in its canonical format",
+				ArgsUsage: "[RULE]",
+				Action:    handleFmt,
+			},
 		},
 	}
 
@@ -0,0 +1,340 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	histweet "github.com/aksiksi/histweet/lib"
+)
+
+// Supported output formats
+const (
+	outputText   = "text"
+	outputJSON   = "json"
+	outputNDJSON = "ndjson"
+)
+
+// Record for a single matched tweet
+type tweetRecord struct {
+	Type        string    `json:"type,omitempty"`
+	ID          int64     `json:"id"`
+	CreatedAt   time.Time `json:"created_at"`
+	Text        string    `json:"text"`
+	NumLikes    int       `json:"likes"`
+	NumRetweets int       `json:"retweets"`
+	MatchedRule string    `json:"matched_rule,omitempty"`
+
+	// Why the tweet matched, if requested
+	Explanation *histweet.Explanation `json:"explanation,omitempty"`
+}
+
+// Record for the result of deleting a single tweet
+type deletionRecord struct {
+	Type    string `json:"type,omitempty"`
+	ID      int64  `json:"id"`
+	Success bool   `json:"success"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Record for the rules that are being applied
+type rulesRecord struct {
+	Type  string   `json:"type,omitempty"`
+	Rules []string `json:"rules"`
+}
+
+// Record for the final summary of a run
+type summaryRecord struct {
+	Type    string `json:"type,omitempty"`
+	Matched int    `json:"matched"`
+	Deleted int    `json:"deleted"`
+	Skipped int    `json:"skipped"`
+	Failed  int    `json:"failed"`
+	DryRun  bool   `json:"dry_run"`
+	Aborted bool   `json:"aborted"`
+	Plan    string `json:"plan,omitempty"`
+}
+
+// output renders the results of a CLI command, either as human-readable text
+// or as structured records
+type output interface {
+	histweet.Observer
+
+	// Reports the rules that are being applied
+	rules(rules []string)
+
+	// Reports all tweets that matched the rules. If explain is set, the
+	// tweets are reported along with why they matched it in the given
+	// context.
+	matched(tweets []histweet.Tweet, explain *histweet.Rule, ctx *histweet.EvalContext)
+
+	// Reports the final summary of a run
+	summary(summary *summaryRecord, failed map[int64]error)
+
+	// Prints a human-readable message
+	info(format string, a ...interface{})
+
+	// Returns the writer to use for interactive prompts
+	prompt() io.Writer
+
+	// Writes out any buffered records at the end of a run
+	flush() error
+}
+
+func newOutput(format string, w io.Writer) (output, error) {
+	switch format {
+	case outputText, "":
+		return &textOutput{w: w}, nil
+	case outputJSON:
+		return &jsonOutput{w: w}, nil
+	case outputNDJSON:
+		return &jsonOutput{w: w, stream: true}, nil
+	default:
+		return nil, fmt.Errorf("Invalid output format \"%s\" - must be one of: text, json, ndjson", format)
+	}
+}
+
+func newTweetRecord(tweet *histweet.Tweet) *tweetRecord {
+	return &tweetRecord{
+		ID:          tweet.ID,
+		CreatedAt:   tweet.CreatedAt,
+		Text:        tweet.Text,
+		NumLikes:    tweet.NumLikes,
+		NumRetweets: tweet.NumRetweets,
+		MatchedRule: tweet.MatchedRule,
+	}
+}
+
+// Human-readable output
+type textOutput struct {
+	w io.Writer
+}
+
+func (out *textOutput) OnEvent(event *histweet.Event) {}
+
+func (out *textOutput) rules(rules []string) {
+	fmt.Fprintln(out.w, "\nRules")
+	fmt.Fprintln(out.w, "=====")
+
+	for _, rule := range rules {
+		fmt.Fprintf(out.w, "  * Rule: %s\n", rule)
+	}
+}
+
+func (out *textOutput) matched(tweets []histweet.Tweet, explain *histweet.Rule, ctx *histweet.EvalContext) {
+	if explain != nil {
+		out.explained(tweets, explain, ctx)
+		return
+	}
+
+	// Only list the tweets if we know which named rule matched each one
+	hasNamedRule := false
+
+	for _, tweet := range tweets {
+		if tweet.MatchedRule != "" {
+			hasNamedRule = true
+			break
+		}
+	}
+
+	if !hasNamedRule {
+		return
+	}
+
+	fmt.Fprintln(out.w, "\nMatched tweets")
+	fmt.Fprintln(out.w, "==============")
+
+	for _, tweet := range tweets {
+		fmt.Fprintf(out.w, "  * [%s] %d: %s\n", tweet.MatchedRule, tweet.ID, tweet.Excerpt(60))
+	}
+}
+
+// Prints each matched tweet along with why it matched the given rule
+func (out *textOutput) explained(tweets []histweet.Tweet, rule *histweet.Rule, ctx *histweet.EvalContext) {
+	fmt.Fprintln(out.w, "\nMatched tweets")
+	fmt.Fprintln(out.w, "==============")
+
+	for i := range tweets {
+		tweet := &tweets[i]
+
+		if tweet.MatchedRule != "" {
+			fmt.Fprintf(out.w, "  * [%s] %d: %s\n", tweet.MatchedRule, tweet.ID, tweet.Excerpt(60))
+		} else {
+			fmt.Fprintf(out.w, "  * %d: %s\n", tweet.ID, tweet.Excerpt(60))
+		}
+
+		explanation := rule.Explain(ctx, tweet)
+		if explanation == nil {
+			continue
+		}
+
+		for _, line := range strings.Split(strings.TrimSuffix(explanation.String(), "\n"), "\n") {
+			fmt.Fprintf(out.w, "      %s\n", line)
+		}
+	}
+}
+
+func (out *textOutput) summary(summary *summaryRecord, failed map[int64]error) {
+	// Nothing was deleted, and the reason was already printed
+	if summary.Aborted || summary.Matched == 0 {
+		return
+	}
+
+	if summary.DryRun {
+		fmt.Fprintf(out.w, "Dry run: no tweets were deleted. Run \"histweet apply %s\" to delete them.\n", summary.Plan)
+		return
+	}
+
+	fmt.Fprintln(out.w, "\nSummary")
+	fmt.Fprintln(out.w, "=======")
+	fmt.Fprintf(out.w, "  * Deleted: %d\n", summary.Deleted)
+
+	if summary.Skipped > 0 {
+		fmt.Fprintf(out.w, "  * Skipped (already deleted): %d\n", summary.Skipped)
+	}
+
+	fmt.Fprintf(out.w, "  * Failed: %d\n", summary.Failed)
+
+	for id, err := range failed {
+		fmt.Fprintf(out.w, "    - %d: %s\n", id, err)
+	}
+}
+
+func (out *textOutput) info(format string, a ...interface{}) {
+	fmt.Fprintf(out.w, format, a...)
+}
+
+func (out *textOutput) prompt() io.Writer {
+	return out.w
+}
+
+func (out *textOutput) flush() error {
+	return nil
+}
+
+// Structured output, as a single JSON document per run or as a stream of
+// newline-delimited JSON records
+type jsonOutput struct {
+	w      io.Writer
+	stream bool
+	err    error
+
+	// Buffered records for the JSON document
+	doc struct {
+		Rules     []string          `json:"rules"`
+		Matched   []*tweetRecord    `json:"matched"`
+		Deletions []*deletionRecord `json:"deletions"`
+		Summary   *summaryRecord    `json:"summary"`
+	}
+
+	mu sync.Mutex
+}
+
+// Must be called with the lock held
+func (out *jsonOutput) write(record interface{}) {
+	if out.err != nil {
+		return
+	}
+
+	out.err = json.NewEncoder(out.w).Encode(record)
+}
+
+func (out *jsonOutput) OnEvent(event *histweet.Event) {
+	if event.Kind != histweet.EventTweetDeleted && event.Kind != histweet.EventTweetFailed {
+		return
+	}
+
+	out.mu.Lock()
+	defer out.mu.Unlock()
+
+	record := &deletionRecord{
+		ID:      event.Tweet.ID,
+		Success: event.Kind == histweet.EventTweetDeleted,
+	}
+
+	if event.Err != nil {
+		record.Error = event.Err.Error()
+	}
+
+	if out.stream {
+		record.Type = "deletion"
+		out.write(record)
+	} else {
+		out.doc.Deletions = append(out.doc.Deletions, record)
+	}
+}
+
+func (out *jsonOutput) rules(rules []string) {
+	out.mu.Lock()
+	defer out.mu.Unlock()
+
+	if out.stream {
+		out.write(&rulesRecord{Type: "rules", Rules: rules})
+	} else {
+		out.doc.Rules = rules
+	}
+}
+
+func (out *jsonOutput) matched(tweets []histweet.Tweet, explain *histweet.Rule, ctx *histweet.EvalContext) {
+	out.mu.Lock()
+	defer out.mu.Unlock()
+
+	for i := range tweets {
+		record := newTweetRecord(&tweets[i])
+
+		if explain != nil {
+			record.Explanation = explain.Explain(ctx, &tweets[i])
+		}
+
+		if out.stream {
+			record.Type = "tweet"
+			out.write(record)
+		} else {
+			out.doc.Matched = append(out.doc.Matched, record)
+		}
+	}
+}
+
+func (out *jsonOutput) summary(summary *summaryRecord, failed map[int64]error) {
+	out.mu.Lock()
+	defer out.mu.Unlock()
+
+	if out.stream {
+		summary.Type = "summary"
+		out.write(summary)
+	} else {
+		out.doc.Summary = summary
+	}
+}
+
+// Messages are not part of the structured output, so they go to stderr
+func (out *jsonOutput) info(format string, a ...interface{}) {
+	fmt.Fprintf(os.Stderr, format, a...)
+}
+
+func (out *jsonOutput) prompt() io.Writer {
+	return os.Stderr
+}
+
+func (out *jsonOutput) flush() error {
+	out.mu.Lock()
+	defer out.mu.Unlock()
+
+	if !out.stream {
+		out.write(&out.doc)
+
+		// Keep the rules for the next run (i.e., in daemon mode)
+		out.doc.Matched = nil
+		out.doc.Deletions = nil
+		out.doc.Summary = nil
+	}
+
+	err := out.err
+	out.err = nil
+
+	return err
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	histweet "github.com/aksiksi/histweet/lib"
+)
+
+const (
+	// Minimum time between two progress updates
+	progressInterval = 250 * time.Millisecond
+)
+
+// Renders progress events on a single, continuously updated line
+type progressRenderer struct {
+	out   io.Writer
+	start time.Time
+
+	// Total number of tweets to delete, or 0 while fetching
+	total int
+
+	fetched int
+	matched int
+	deleted int
+	failed  int
+
+	// Time at which the current rate limit window resets
+	waitUntil time.Time
+
+	lastRender time.Time
+	mu         sync.Mutex
+}
+
+func newProgressRenderer(out io.Writer, total int) *progressRenderer {
+	return &progressRenderer{
+		out:   out,
+		start: time.Now(),
+		total: total,
+	}
+}
+
+// OnEvent implements histweet.Observer
+func (p *progressRenderer) OnEvent(event *histweet.Event) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	force := false
+
+	switch event.Kind {
+	case histweet.EventPageFetched:
+		p.fetched += event.Count
+	case histweet.EventTweetMatched:
+		p.matched++
+	case histweet.EventTweetDeleted:
+		p.deleted++
+	case histweet.EventTweetFailed:
+		p.failed++
+	case histweet.EventRateLimitWait:
+		p.waitUntil = time.Now().Add(event.Wait)
+		force = true
+	}
+
+	if force || time.Since(p.lastRender) >= progressInterval {
+		p.render()
+	}
+}
+
+// Finish renders the final progress and ends the progress line
+func (p *progressRenderer) Finish() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.render()
+	fmt.Fprintln(p.out)
+}
+
+// Must be called with the lock held
+func (p *progressRenderer) render() {
+	p.lastRender = time.Now()
+	elapsed := time.Since(p.start)
+
+	var line string
+
+	if p.total == 0 {
+		line = fmt.Sprintf("Fetched %d tweets, matched %d", p.fetched, p.matched)
+	} else {
+		processed := p.deleted + p.failed
+		rate := float64(processed) / elapsed.Seconds()
+
+		line = fmt.Sprintf("Deleted %d/%d tweets (%d failed), %.1f tweets/s", p.deleted, p.total, p.failed, rate)
+
+		if processed > 0 && processed < p.total {
+			remaining := time.Duration(float64(p.total-processed) / rate * float64(time.Second))
+			line += fmt.Sprintf(", ETA %s", remaining.Round(time.Second))
+		}
+	}
+
+	if wait := time.Until(p.waitUntil); wait > 0 {
+		line += fmt.Sprintf(", waiting %s for rate limit", wait.Round(time.Second))
+	}
+
+	// Clear the rest of the line, in case the previous line was longer
+	fmt.Fprintf(p.out, "\r%s\033[K", line)
+}
+
+// Forwards each event to multiple observers
+type multiObserver []histweet.Observer
+
+// OnEvent implements histweet.Observer
+func (observers multiObserver) OnEvent(event *histweet.Event) {
+	for _, observer := range observers {
+		observer.OnEvent(event)
+	}
+}
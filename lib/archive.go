@@ -1,26 +1,63 @@
 package histweet
 
 import (
+	"archive/zip"
+	"bufio"
 	"encoding/json"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"log"
 	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
 )
 
 const (
-	archiveTimeLayout = "Mon Jan 02 15:04:05 -0700 2006"
-	archiveSkipHeader = "window.YTD.tweet.part0 = "
+	archiveTimeLayout    = "Mon Jan 02 15:04:05 -0700 2006"
+	archiveMaxHeaderSize = 128
+
+	// Number of archive tweets per page fetched event
+	archivePageSize = 200
 )
 
+// Matches the header that precedes the JSON in each archive part, e.g.,
+// "window.YTD.tweet.part0 ="
+var archiveHeaderPattern = regexp.MustCompile(`^\s*window\.YTD\.\w+\.part\d+\s*=$`)
+
+// Matches the file names of tweet archive parts, e.g., "tweet.js" or
+// "tweets-part1.js"
+var archivePartPattern = regexp.MustCompile(`^tweets?(-part(\d+))?\.js$`)
+
+// Matches links to other tweets, which is how quote tweets are represented
+// in the archive
+var archiveQuotePattern = regexp.MustCompile(`^https?://(mobile\.)?twitter\.com/\w+/status/\d+`)
+
 // Relevant fields for a tweet in archive JSON format
 type archiveTweet struct {
-	IDStr            string `json:"id"`
-	CreatedAt        string `json:"created_at"`
-	FullText         string `json:"full_text"`
-	FavoriteCountStr string `json:"favorite_count"`
-	RetweetCountStr  string `json:"retweet_count"`
+	IDStr             string           `json:"id"`
+	CreatedAt         string           `json:"created_at"`
+	FullText          string           `json:"full_text"`
+	FavoriteCountStr  string           `json:"favorite_count"`
+	RetweetCountStr   string           `json:"retweet_count"`
+	InReplyToStatusID string           `json:"in_reply_to_status_id_str"`
+	InReplyToUserID   string           `json:"in_reply_to_user_id_str"`
+	Entities          archiveEntities  `json:"entities"`
+	ExtendedEntities  *archiveEntities `json:"extended_entities"`
+}
+
+type archiveURL struct {
+	ExpandedURL string `json:"expanded_url"`
+}
+
+type archiveEntities struct {
+	URLs  []archiveURL `json:"urls"`
+	Media []archiveURL `json:"media"`
 }
 
 type archiveEntry struct {
@@ -33,6 +70,8 @@ func convertArchiveTweet(from *archiveTweet) Tweet {
 	createdAt, _ := time.Parse(archiveTimeLayout, from.CreatedAt)
 	favoriteCount, _ := strconv.Atoi(from.FavoriteCountStr)
 	retweetCount, _ := strconv.Atoi(from.RetweetCountStr)
+	inReplyToStatusID, _ := strconv.ParseInt(from.InReplyToStatusID, 10, 64)
+	inReplyToUserID, _ := strconv.ParseInt(from.InReplyToUserID, 10, 64)
 
 	tweet := Tweet{
 		ID:          tweetID,
@@ -40,73 +79,303 @@ func convertArchiveTweet(from *archiveTweet) Tweet {
 		Text:        from.FullText,
 		NumLikes:    favoriteCount,
 		NumRetweets: retweetCount,
-		IsRetweet:   from.FullText[:3] == "RT",
-		IsReply:     from.FullText[:1] == "@",
+		IsRetweet:   strings.HasPrefix(from.FullText, "RT @"),
+		IsReply:     from.InReplyToStatusID != "",
+		HasMedia:    len(from.Entities.Media) > 0,
+		HasLink:     len(from.Entities.URLs) > 0,
+
+		InReplyToStatusID: inReplyToStatusID,
+		InReplyToUserID:   inReplyToUserID,
+	}
+
+	if from.ExtendedEntities != nil {
+		tweet.HasMedia = tweet.HasMedia || len(from.ExtendedEntities.Media) > 0
+	}
+
+	for _, url := range from.Entities.URLs {
+		if archiveQuotePattern.MatchString(url.ExpandedURL) {
+			tweet.IsQuote = true
+			break
+		}
 	}
 
 	return tweet
 }
 
-// FetchArchiveTweets parses all tweets in the provided Twitter archive and
-// checks them against the provided Rule. The output is a list of Tweets that
-// match the rule (i.e., to be deleted).
-func FetchArchiveTweets(rule *ParsedRule, archive string) ([]Tweet, error) {
-	var err error
-	var f *os.File
-	var info os.FileInfo
+// Reads the "window.YTD.<name>.partN =" header that precedes the JSON in each
+// archive part
+func skipArchiveHeader(r *bufio.Reader) error {
+	var header []byte
+
+	for len(header) < archiveMaxHeaderSize {
+		c, err := r.ReadByte()
+		if err == io.EOF {
+			return fmt.Errorf("Archive is missing the \"window.YTD\" header")
+		} else if err != nil {
+			return err
+		}
+
+		header = append(header, c)
+
+		if c == '=' {
+			if !archiveHeaderPattern.Match(header) {
+				return fmt.Errorf("Invalid archive header: %s", header)
+			}
 
-	f, err = os.Open(archive)
+			return nil
+		}
+	}
+
+	return fmt.Errorf("Archive is missing the \"window.YTD\" header")
+}
+
+// Streams all tweets in a single archive part, calling fn on each tweet.
+// Returns the number of tweets read from the archive.
+func readArchive(r io.Reader, fn func(tweet *Tweet) error) (int, error) {
+	reader := bufio.NewReader(r)
+
+	err := skipArchiveHeader(reader)
 	if err != nil {
-		return nil, err
+		return 0, err
 	}
 
-	// Find file size
-	info, _ = f.Stat()
+	decoder := json.NewDecoder(reader)
+
+	// The archive is a single JSON array of tweet entries
+	token, err := decoder.Token()
 	if err != nil {
-		return nil, err
+		return 0, err
+	} else if token != json.Delim('[') {
+		return 0, fmt.Errorf("Invalid archive: expected a JSON array")
 	}
 
-	headerSize := int64(len(archiveSkipHeader))
+	count := 0
+
+	for decoder.More() {
+		var entry archiveEntry
+
+		err = decoder.Decode(&entry)
+		if err != nil {
+			return count, err
+		}
+
+		tweet := convertArchiveTweet(&entry.Tweet)
+
+		err = fn(&tweet)
+		if err != nil {
+			return count, err
+		}
 
-	fileSize := info.Size()
-	if fileSize <= headerSize {
-		return nil, fmt.Errorf("Input archive size (%d bytes) is too small", fileSize)
+		count++
 	}
 
-	// Skip header to get to valid JSON
-	_, err = f.Seek(headerSize, 0)
+	_, err = decoder.Token()
 	if err != nil {
-		return nil, err
+		return count, err
 	}
 
-	// Allocate buffer of exact size to hold raw JSON string
-	buf := make([]byte, fileSize-headerSize)
-	_, err = f.Read(buf)
+	return count, nil
+}
+
+// Streams all tweets in the archive part at the given path
+func readArchiveFile(path string, fn func(tweet *Tweet) error) (int, error) {
+	f, err := os.Open(path)
 	if err != nil {
-		return nil, err
+		return 0, err
+	}
+	defer f.Close()
+
+	return readArchive(f, fn)
+}
+
+// Returns the part number of the given archive part. Parts without a number
+// (e.g., tweet.js) come first.
+func archivePartNumber(name string) int {
+	matches := archivePartPattern.FindStringSubmatch(name)
+	if matches == nil || matches[2] == "" {
+		return 0
+	}
+
+	num, _ := strconv.Atoi(matches[2])
+
+	return num
+}
+
+// Finds all tweet archive parts in the given directory, sorted by part number.
+// If the directory contains a "data" directory (i.e., it is the root of an
+// extracted archive), the parts are looked up in there instead.
+func findArchiveParts(dir string) ([]string, error) {
+	dataDir := filepath.Join(dir, "data")
+	if info, err := os.Stat(dataDir); err == nil && info.IsDir() {
+		dir = dataDir
 	}
 
-	// Parse tweet archive as JSON
-	var origTweets []archiveEntry
-	err = json.Unmarshal(buf, &origTweets)
+	files, err := ioutil.ReadDir(dir)
 	if err != nil {
 		return nil, err
 	}
 
-	log.Printf("Loaded %d tweets from provided archive", len(origTweets))
+	var parts []string
 
-	// Allocate buffer for tweet IDs that need to be deleted
-	tweets := make([]Tweet, 0, len(origTweets))
+	for _, file := range files {
+		if !file.IsDir() && archivePartPattern.MatchString(file.Name()) {
+			parts = append(parts, file.Name())
+		}
+	}
 
-	for _, entry := range origTweets {
-		// Convert tweet
-		tweet := convertArchiveTweet(&entry.Tweet)
+	if len(parts) == 0 {
+		return nil, fmt.Errorf("No tweet archive files found in %s", dir)
+	}
+
+	sort.Slice(parts, func(i, j int) bool {
+		return archivePartNumber(parts[i]) < archivePartNumber(parts[j])
+	})
+
+	for i, part := range parts {
+		parts[i] = filepath.Join(dir, part)
+	}
+
+	return parts, nil
+}
+
+// Streams all tweets in the Twitter archive ZIP at the given path. The tweet
+// archive parts are read directly from the "data" directory in the ZIP.
+func readArchiveZip(archive string, fn func(tweet *Tweet) error) (int, error) {
+	r, err := zip.OpenReader(archive)
+	if err != nil {
+		return 0, err
+	}
+	defer r.Close()
+
+	var parts []*zip.File
+
+	for _, f := range r.File {
+		dir, name := path.Split(f.Name)
+		if dir == "data/" && archivePartPattern.MatchString(name) {
+			parts = append(parts, f)
+		}
+	}
+
+	if len(parts) == 0 {
+		return 0, fmt.Errorf("No tweet archive files found in %s", archive)
+	}
+
+	sort.Slice(parts, func(i, j int) bool {
+		return archivePartNumber(path.Base(parts[i].Name)) < archivePartNumber(path.Base(parts[j].Name))
+	})
+
+	total := 0
+
+	for _, part := range parts {
+		f, err := part.Open()
+		if err != nil {
+			return total, err
+		}
+
+		count, err := readArchive(f, fn)
+		f.Close()
+
+		if err != nil {
+			return total, fmt.Errorf("%s: %w", part.Name, err)
+		}
+
+		total += count
+	}
+
+	return total, nil
+}
+
+// ScanArchive streams every tweet in the provided Twitter archive, calling fn
+// on each one. Each path can either be a single archive part (e.g., tweet.js),
+// a directory containing one or more parts (e.g., tweets-part1.js), or the
+// archive ZIP downloaded from Twitter. Tweets are read one at a time, so the
+// archive is never fully loaded into memory (or extracted to disk).
+func ScanArchive(fn func(tweet *Tweet) error, paths ...string) error {
+	total := 0
+
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+
+		if strings.EqualFold(filepath.Ext(path), ".zip") {
+			count, err := readArchiveZip(path, fn)
+			if err != nil {
+				return fmt.Errorf("Failed to read archive %s: %w", path, err)
+			}
+
+			total += count
 
+			continue
+		}
+
+		parts := []string{path}
+
+		if info.IsDir() {
+			parts, err = findArchiveParts(path)
+			if err != nil {
+				return err
+			}
+		}
+
+		for _, part := range parts {
+			count, err := readArchiveFile(part, fn)
+			if err != nil {
+				return fmt.Errorf("Failed to read archive %s: %w", part, err)
+			}
+
+			total += count
+		}
+	}
+
+	log.Printf("Loaded %d tweets from provided archive", total)
+
+	return nil
+}
+
+// FetchArchiveTweets parses all tweets in the provided Twitter archive and
+// checks them against the provided Rule. The output is a list of Tweets that
+// match the rule (i.e., to be deleted).
+//
+// Refer to ScanArchive for the supported archive paths.
+func FetchArchiveTweets(rule *Rule, opts *FetchOptions, paths ...string) ([]Tweet, error) {
+	if opts == nil {
+		opts = &FetchOptions{}
+	}
+
+	var tweets []Tweet
+
+	ctx := opts.Context.resolve()
+
+	// Number of tweets read since the last page event
+	count := 0
+
+	err := ScanArchive(func(tweet *Tweet) error {
 		// If the tweet matches the provided rule, append it to the tweet
 		// list
-		if rule.Eval(&tweet) {
-			tweets = append(tweets, tweet)
+		if rule.Match(ctx, tweet) {
+			matched := *tweet
+			tweets = append(tweets, matched)
+
+			notify(opts.Observer, &Event{Kind: EventTweetMatched, Tweet: &matched})
 		}
+
+		// Report progress in pages, similar to the timeline API
+		count++
+		if count == archivePageSize {
+			notify(opts.Observer, &Event{Kind: EventPageFetched, Count: count})
+			count = 0
+		}
+
+		return nil
+	}, paths...)
+	if err != nil {
+		return nil, err
+	}
+
+	if count > 0 {
+		notify(opts.Observer, &Event{Kind: EventPageFetched, Count: count})
 	}
 
 	// Return the list of tweets to delete
@@ -1,11 +1,18 @@
 package histweet
 
 import (
+	"archive/zip"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
 func TestTwitterArchive(t *testing.T) {
 	tweetRule, _ := Parse(`likes >= 3 || text ~ "Potato"`)
+	rule := &Rule{Tweet: tweetRule}
 
 	var inputs = []struct {
 		archive         string
@@ -18,11 +25,12 @@ func TestTwitterArchive(t *testing.T) {
 		{"junk123.js", -1},
 		{"sample_archive_no_size.js", -1},
 		{"sample_archive_invalid.js", -1},
+		{"sample_archive_bad_header.js", -1},
 	}
 
 	for _, input := range inputs {
 		t.Run(input.archive, func(t *testing.T) {
-			tweets, err := FetchArchiveTweets(tweetRule, input.archive)
+			tweets, err := FetchArchiveTweets(rule, nil, input.archive)
 			if err != nil {
 				if input.expectedMatches == -1 {
 					t.Logf("Invalid archive detected -- %s", err)
@@ -39,3 +47,256 @@ func TestTwitterArchive(t *testing.T) {
 	}
 
 }
+
+func TestTwitterArchiveAttributes(t *testing.T) {
+	var inputs = []struct {
+		rule            string
+		expectedMatches int
+	}{
+		{"is_retweet == true", 1},
+		{"is_retweet != true", 2},
+		{"is_reply == true && has_media == true", 1},
+		{"is_quote == true && has_link == true", 1},
+		{"has_link == false", 2},
+	}
+
+	for _, input := range inputs {
+		t.Run(input.rule, func(t *testing.T) {
+			tweetRule, err := Parse(input.rule)
+			if err != nil {
+				t.Fatalf("Failed to parse rule: %s", err)
+			}
+
+			tweets, err := FetchArchiveTweets(&Rule{Tweet: tweetRule}, nil, "sample_archive.js")
+			if err != nil {
+				t.Fatalf("Failed: %s", err)
+			}
+
+			if len(tweets) != input.expectedMatches {
+				t.Errorf("Error: %d tweets matched, expected %d", len(tweets), input.expectedMatches)
+			}
+		})
+	}
+}
+
+func TestConvertArchiveTweetReply(t *testing.T) {
+	var inputs = []struct {
+		tweet    archiveTweet
+		expected bool
+	}{
+		{archiveTweet{FullText: "@EmilyKager Same here", InReplyToStatusID: "1234567", InReplyToUserID: "42"}, true},
+		{archiveTweet{FullText: "Same here", InReplyToStatusID: "1234567"}, true},
+		{archiveTweet{FullText: "@EmilyKager is hiring!"}, false},
+	}
+
+	for _, input := range inputs {
+		tweet := convertArchiveTweet(&input.tweet)
+		if tweet.IsReply != input.expected {
+			t.Errorf("Expected IsReply to be %v for tweet: %+v", input.expected, input.tweet)
+		}
+
+		if input.tweet.InReplyToUserID == "42" && (tweet.InReplyToUserID != 42 || tweet.InReplyToStatusID != 1234567) {
+			t.Errorf("Unexpected reply IDs for tweet: %+v", tweet)
+		}
+	}
+}
+
+// Writes the sample archive into the given directory as multiple parts
+func writeArchiveParts(t *testing.T, dir string, names ...string) {
+	buf, err := ioutil.ReadFile("sample_archive.js")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, name := range names {
+		// Each part has its own header
+		header := fmt.Sprintf("window.YTD.tweets.part%d =", i)
+		data := strings.Replace(string(buf), "window.YTD.tweet.part0 =", header, 1)
+
+		err = ioutil.WriteFile(filepath.Join(dir, name), []byte(data), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestTwitterArchiveParts(t *testing.T) {
+	tweetRule, _ := Parse(`likes >= 3 || text ~ "Potato"`)
+	rule := &Rule{Tweet: tweetRule}
+
+	dir, err := ioutil.TempDir("", "histweet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeArchiveParts(t, dir, "tweets-part1.js", "tweets-part2.js", "tweets-part10.js")
+
+	// Unrelated files in the directory are ignored
+	err = ioutil.WriteFile(filepath.Join(dir, "like.js"), []byte("junk"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var inputs = []struct {
+		name            string
+		paths           []string
+		expectedMatches int
+	}{
+		{"directory", []string{dir}, 6},
+		{"parts", []string{filepath.Join(dir, "tweets-part1.js"), filepath.Join(dir, "tweets-part2.js")}, 4},
+		{"mixed", []string{dir, "sample_archive.js"}, 8},
+		{"invalid", []string{dir, filepath.Join(dir, "like.js")}, -1},
+	}
+
+	for _, input := range inputs {
+		t.Run(input.name, func(t *testing.T) {
+			tweets, err := FetchArchiveTweets(rule, nil, input.paths...)
+			if err != nil {
+				if input.expectedMatches == -1 {
+					t.Logf("Invalid archive detected -- %s", err)
+					return
+				}
+
+				t.Fatalf("Failed: %s", err)
+			}
+
+			if len(tweets) != input.expectedMatches {
+				t.Errorf("Error: %d tweets matched, expected %d", len(tweets), input.expectedMatches)
+			}
+		})
+	}
+
+	// Parts must be read in order
+	var ids []int64
+
+	err = ScanArchive(func(tweet *Tweet) error {
+		ids = append(ids, tweet.ID)
+		return nil
+	}, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(ids) != 9 || ids[0] != 1234567 || ids[8] != 13141516 {
+		t.Errorf("Unexpected tweets read from archive: %v", ids)
+	}
+
+	// A directory without any parts is invalid
+	emptyDir, err := ioutil.TempDir("", "histweet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(emptyDir)
+
+	_, err = FetchArchiveTweets(rule, nil, emptyDir)
+	if err == nil {
+		t.Errorf("Expected an error for an empty archive directory")
+	}
+}
+
+func TestArchivePartNumber(t *testing.T) {
+	var inputs = map[string]int{
+		"tweet.js":         0,
+		"tweets.js":        0,
+		"tweet-part1.js":   1,
+		"tweets-part12.js": 12,
+		"like.js":          0,
+	}
+
+	for name, expected := range inputs {
+		if num := archivePartNumber(name); num != expected {
+			t.Errorf("Part number for %s: %d != expected %d", name, num, expected)
+		}
+	}
+}
+
+// Writes a ZIP to the given path that mimics the layout of the archive
+// downloaded from Twitter
+func writeArchiveZip(t *testing.T, path string, names ...string) {
+	buf, err := ioutil.ReadFile("sample_archive.js")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	w := zip.NewWriter(f)
+
+	for _, name := range names {
+		entry, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = entry.Write(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = w.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTwitterArchiveZip(t *testing.T) {
+	tweetRule, _ := Parse(`likes >= 3 || text ~ "Potato"`)
+	rule := &Rule{Tweet: tweetRule}
+
+	dir, err := ioutil.TempDir("", "histweet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var inputs = []struct {
+		name            string
+		entries         []string
+		expectedMatches int
+	}{
+		{"single.zip", []string{"Your archive.html", "data/tweet.js", "data/like.js"}, 2},
+		{"parts.ZIP", []string{"data/tweets-part1.js", "data/tweets-part2.js", "data/tweets.js"}, 6},
+		{"nested.zip", []string{"data/tweets/tweet.js", "tweet.js"}, -1},
+		{"empty.zip", []string{}, -1},
+	}
+
+	for _, input := range inputs {
+		t.Run(input.name, func(t *testing.T) {
+			path := filepath.Join(dir, input.name)
+			writeArchiveZip(t, path, input.entries...)
+
+			tweets, err := FetchArchiveTweets(rule, nil, path)
+			if err != nil {
+				if input.expectedMatches == -1 {
+					t.Logf("Invalid archive detected -- %s", err)
+					return
+				}
+
+				t.Fatalf("Failed: %s", err)
+			}
+
+			if len(tweets) != input.expectedMatches {
+				t.Errorf("Error: %d tweets matched, expected %d", len(tweets), input.expectedMatches)
+			}
+		})
+	}
+
+	// A file that isn't actually a ZIP
+	junk := filepath.Join(dir, "junk.zip")
+
+	err = ioutil.WriteFile(junk, []byte("junk"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = FetchArchiveTweets(rule, nil, junk)
+	if err == nil {
+		t.Errorf("Expected an error for an invalid ZIP")
+	}
+}
@@ -0,0 +1,372 @@
+package histweet
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// NodeType is the type of a Node in the AST of a rule
+type NodeType string
+
+// Types of AST nodes
+const (
+	// Both children must match
+	NodeAnd NodeType = "and"
+
+	// At least one of the children must match
+	NodeOr NodeType = "or"
+
+	// The only child must not match
+	NodeNot NodeType = "not"
+
+	// A single condition on a tweet field
+	NodeCond NodeType = "cond"
+)
+
+// LiteralType is the type of a Literal in a condition
+type LiteralType string
+
+// Types of literals
+const (
+	LiteralNumber  LiteralType = "number"
+	LiteralString  LiteralType = "string"
+	LiteralAge     LiteralType = "age"
+	LiteralTime    LiteralType = "time"
+	LiteralBool    LiteralType = "bool"
+	LiteralWeekday LiteralType = "weekday"
+	LiteralRange   LiteralType = "range"
+)
+
+// Literal is the value that a tweet field is compared against.
+//
+// The value is stored as it appears in a rule string, except that strings are
+// not quoted (e.g., "3d" for an age, or "10-May-2020" for a time). Flags are
+// the regexp flags that follow a string, if any (e.g., "i").
+type Literal struct {
+	Type  LiteralType `json:"type"`
+	Value string      `json:"value"`
+	Flags string      `json:"flags,omitempty"`
+}
+
+// Node is a single node in the AST of a rule.
+//
+// "and" and "or" nodes have two or more children, which are combined from
+// left to right. "not" nodes have exactly one child. "cond" nodes have no
+// children, and compare a tweet Field against a Literal using an Operator
+// (e.g., ">=", "~", or "contains").
+type Node struct {
+	Type     NodeType `json:"type"`
+	Field    string   `json:"field,omitempty"`
+	Operator string   `json:"operator,omitempty"`
+	Literal  *Literal `json:"literal,omitempty"`
+	Children []*Node  `json:"children,omitempty"`
+}
+
+// Maps each literal token to its literal type
+var literalTypes = map[tokenKind]LiteralType{
+	tokenNumber: LiteralNumber,
+	tokenString: LiteralString,
+	tokenAge:    LiteralAge,
+	tokenTime:   LiteralTime,
+	tokenBool:   LiteralBool,
+
+	tokenWeekday: LiteralWeekday,
+	tokenRange:   LiteralRange,
+}
+
+// Maps each comparison operator token to its symbol
+var operatorSymbols = map[tokenKind]string{
+	tokenGt:    ">",
+	tokenGte:   ">=",
+	tokenLt:    "<",
+	tokenLte:   "<=",
+	tokenEq:    "==",
+	tokenNeq:   "!=",
+	tokenIn:    "~",
+	tokenNotIn: "!~",
+
+	tokenContains:   "contains",
+	tokenWord:       "word",
+	tokenStartsWith: "startswith",
+	tokenEndsWith:   "endswith",
+	tokenInRange:    "in",
+}
+
+// And builds a node that matches if all of the given nodes match
+func And(nodes ...*Node) *Node {
+	return &Node{Type: NodeAnd, Children: nodes}
+}
+
+// Or builds a node that matches if any of the given nodes match
+func Or(nodes ...*Node) *Node {
+	return &Node{Type: NodeOr, Children: nodes}
+}
+
+// Not builds a node that matches if the given node does not match
+func Not(node *Node) *Node {
+	return &Node{Type: NodeNot, Children: []*Node{node}}
+}
+
+// Cond builds a node that compares a tweet field against a literal, e.g.,
+// Cond("likes", ">", NumberLiteral(3))
+func Cond(field, operator string, literal Literal) *Node {
+	return &Node{Type: NodeCond, Field: field, Operator: operator, Literal: &literal}
+}
+
+// NumberLiteral builds a number literal
+func NumberLiteral(n int) Literal {
+	return Literal{Type: LiteralNumber, Value: strconv.Itoa(n)}
+}
+
+// StringLiteral builds a string literal, e.g., a regexp for "text"
+func StringLiteral(s string) Literal {
+	return Literal{Type: LiteralString, Value: s}
+}
+
+// AgeLiteral builds an age literal, e.g., "1y3m"
+func AgeLiteral(age string) Literal {
+	return Literal{Type: LiteralAge, Value: age}
+}
+
+// TimeLiteral builds a time literal, e.g., "10-May-2020"
+func TimeLiteral(t string) Literal {
+	return Literal{Type: LiteralTime, Value: t}
+}
+
+// BoolLiteral builds a bool literal
+func BoolLiteral(b bool) Literal {
+	return Literal{Type: LiteralBool, Value: strconv.FormatBool(b)}
+}
+
+// WeekdayLiteral builds a weekday literal, e.g., "sat"
+func WeekdayLiteral(day time.Weekday) Literal {
+	return Literal{Type: LiteralWeekday, Value: strings.ToLower(day.String()[:3])}
+}
+
+// RangeLiteral builds a range literal with the given bounds, e.g.,
+// "[2019-01-01, 2019-06-30]"
+func RangeLiteral(from, to Literal) Literal {
+	return Literal{Type: LiteralRange, Value: "[" + formatLiteral(&from) + ", " + formatLiteral(&to) + "]"}
+}
+
+// Converts a literal token to a Literal
+func newLiteral(token *token) *Literal {
+	literal := &Literal{
+		Type:  literalTypes[token.kind],
+		Value: token.val,
+	}
+
+	if token.kind == tokenString {
+		literal.Value, literal.Flags = splitStringLiteral(token.val)
+	}
+
+	return literal
+}
+
+// Converts a Literal back to a token
+func (literal *Literal) token() (*token, error) {
+	for kind, typ := range literalTypes {
+		if typ != literal.Type {
+			continue
+		}
+
+		val := literal.Value
+		if kind == tokenString {
+			val = quoteString(val) + literal.Flags
+		}
+
+		// The value must be exactly what the lexer would have matched
+		pattern := regexp.MustCompile(Tokens[kind] + "$")
+		if !pattern.MatchString(val) {
+			return nil, fmt.Errorf("Invalid %s literal \"%s\"", literal.Type, literal.Value)
+		}
+
+		return &token{kind: kind, val: val, size: len(val)}, nil
+	}
+
+	return nil, fmt.Errorf("Invalid literal type \"%s\"", literal.Type)
+}
+
+// Converts a parse tree to an AST
+func toAST(node *parseNode) *Node {
+	switch node.kind {
+	case nodeCond:
+		return &Node{
+			Type:     NodeCond,
+			Field:    node.ident,
+			Operator: operatorSymbols[node.op],
+			Literal:  newLiteral(node.literal),
+		}
+	case nodeLogical:
+		typ := NodeAnd
+		if node.op == tokenOr {
+			typ = NodeOr
+		}
+
+		return &Node{
+			Type:     typ,
+			Children: []*Node{toAST(node.left), toAST(node.right)},
+		}
+	case nodeNot:
+		return Not(toAST(node.left))
+	default:
+		panic(fmt.Sprintf("Unexpected node type: %d", node.kind))
+	}
+}
+
+// Converts an AST to a parse tree, validating each node along the way
+func fromAST(node *Node, rule *ParsedRule) (*parseNode, error) {
+	if node == nil {
+		return nil, fmt.Errorf("Missing AST node")
+	}
+
+	switch node.Type {
+	case NodeCond:
+		if node.Literal == nil {
+			return nil, fmt.Errorf("Missing literal for \"%s\"", node.Field)
+		}
+
+		ident := &token{kind: tokenIdent, val: node.Field, size: len(node.Field)}
+
+		var op *token
+
+		for kind, symbol := range operatorSymbols {
+			if symbol == node.Operator {
+				op = &token{kind: kind, val: symbol, size: len(symbol)}
+			}
+		}
+
+		if op == nil {
+			return nil, fmt.Errorf("Invalid operator \"%s\"", node.Operator)
+		}
+
+		literal, err := node.Literal.token()
+		if err != nil {
+			return nil, err
+		}
+
+		rule.numNodes++
+
+		return buildCond(ident, op, literal)
+	case NodeAnd, NodeOr:
+		if len(node.Children) < 2 {
+			return nil, fmt.Errorf("\"%s\" node requires at least 2 children", node.Type)
+		}
+
+		op := tokenAnd
+		if node.Type == NodeOr {
+			op = tokenOr
+		}
+
+		left, err := fromAST(node.Children[0], rule)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, child := range node.Children[1:] {
+			right, err := fromAST(child, rule)
+			if err != nil {
+				return nil, err
+			}
+
+			left = &parseNode{
+				kind:  nodeLogical,
+				op:    op,
+				left:  left,
+				right: right,
+			}
+
+			rule.numNodes++
+		}
+
+		return left, nil
+	case NodeNot:
+		if len(node.Children) != 1 {
+			return nil, fmt.Errorf("\"not\" node requires exactly 1 child")
+		}
+
+		child, err := fromAST(node.Children[0], rule)
+		if err != nil {
+			return nil, err
+		}
+
+		rule.numNodes++
+
+		return &parseNode{
+			kind: nodeNot,
+			op:   tokenNot,
+			left: child,
+		}, nil
+	default:
+		return nil, fmt.Errorf("Invalid node type \"%s\"", node.Type)
+	}
+}
+
+// AST returns the abstract syntax tree of this rule
+func (rule *ParsedRule) AST() *Node {
+	return toAST(rule.root)
+}
+
+// HasField returns true if any condition in this AST compares the given field
+func (node *Node) HasField(field string) bool {
+	if node == nil {
+		return false
+	}
+
+	if node.Type == NodeCond {
+		return node.Field == field
+	}
+
+	for _, child := range node.Children {
+		if child.HasField(field) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// FromAST builds a ParsedRule from the given AST. This allows rules to be
+// built programmatically, e.g.:
+//
+//	FromAST(And(Cond("likes", "<", NumberLiteral(3)), Cond("age", ">", AgeLiteral("30d"))))
+func FromAST(root *Node) (*ParsedRule, error) {
+	rule := &ParsedRule{}
+
+	node, err := fromAST(root, rule)
+	if err != nil {
+		return nil, err
+	}
+
+	rule.root = node
+
+	return rule, nil
+}
+
+// MarshalJSON encodes this rule as its AST
+func (rule *ParsedRule) MarshalJSON() ([]byte, error) {
+	return json.Marshal(rule.AST())
+}
+
+// UnmarshalJSON decodes a rule from its AST
+func (rule *ParsedRule) UnmarshalJSON(data []byte) error {
+	var root Node
+
+	err := json.Unmarshal(data, &root)
+	if err != nil {
+		return err
+	}
+
+	parsed, err := FromAST(&root)
+	if err != nil {
+		return err
+	}
+
+	*rule = *parsed
+
+	return nil
+}
@@ -0,0 +1,125 @@
+package histweet
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestASTRoundTrip(t *testing.T) {
+	inputs := []string{
+		"likes > 3",
+		"likes > 3 && retweets <= 2 || text ~ \"hello, world\"",
+		"!(text !~ \"pinned\" || is_retweet == true) && age > 1y3d",
+		"created < 10-May-2020 && (replies == 0 || engagement != 5)",
+		"created in [2019-01-01, 2019-06-30] || hour in [22, 2] && weekday != sun",
+	}
+
+	tweets := []Tweet{
+		{Text: "hello, world", NumLikes: 10, CreatedAt: time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{Text: "pinned", NumLikes: 2, NumRetweets: 1, IsRetweet: true},
+		{Text: "abc", NumReplies: 3, CreatedAt: time.Date(2020, 7, 1, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, input := range inputs {
+		t.Run(input, func(t *testing.T) {
+			rule, err := Parse(input)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			buf, err := json.Marshal(rule)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var decoded ParsedRule
+
+			err = json.Unmarshal(buf, &decoded)
+			if err != nil {
+				t.Fatalf("Failed to decode %s: %s", buf, err)
+			}
+
+			for i := range tweets {
+				if rule.Eval(nil, &tweets[i]) != decoded.Eval(nil, &tweets[i]) {
+					t.Errorf("Decoded rule does not match tweet %d like the original rule: %s", i, buf)
+				}
+			}
+
+			// Encoding the decoded rule must result in the same AST
+			reencoded, err := json.Marshal(&decoded)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if string(reencoded) != string(buf) {
+				t.Errorf("AST changed after a round trip: %s != %s", reencoded, buf)
+			}
+		})
+	}
+}
+
+func TestFromAST(t *testing.T) {
+	root := And(
+		Cond("likes", "<", NumberLiteral(3)),
+		Cond("text", "~", StringLiteral("^RT")),
+		Not(Cond("has_media", "==", BoolLiteral(true))),
+	)
+
+	rule, err := FromAST(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !rule.Eval(nil, &Tweet{Text: "RT hello", NumLikes: 1}) {
+		t.Errorf("Expected rule to match")
+	}
+
+	if rule.Eval(nil, &Tweet{Text: "RT hello", NumLikes: 1, HasMedia: true}) {
+		t.Errorf("Expected rule not to match")
+	}
+
+	// The children of n-ary nodes are combined from left to right
+	ast := rule.AST()
+	if ast.Type != NodeAnd || ast.Children[0].Type != NodeAnd || ast.Children[1].Type != NodeNot {
+		t.Errorf("Unexpected AST: %+v", ast)
+	}
+
+	weekend, err := FromAST(Cond("weekday", "in", RangeLiteral(WeekdayLiteral(time.Saturday), WeekdayLiteral(time.Sunday))))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if formatted := Format(weekend); formatted != "weekday in [sat, sun]" {
+		t.Errorf("Unexpected rule: %s", formatted)
+	}
+
+	if !weekend.Eval(nil, &Tweet{CreatedAt: time.Date(2020, 7, 4, 12, 0, 0, 0, time.UTC)}) {
+		t.Errorf("Expected a tweet from a Saturday to match")
+	}
+
+	invalid := []*Node{
+		nil,
+		{Type: "xor"},
+		And(Cond("likes", "<", NumberLiteral(3))),
+		{Type: NodeNot},
+		{Type: NodeCond, Field: "likes", Operator: "<"},
+		Cond("likes", "<<", NumberLiteral(3)),
+		Cond("likes", "<", Literal{Type: LiteralNumber, Value: "abc"}),
+		Cond("likes", "<", Literal{Type: "float", Value: "1.5"}),
+		Cond("age", ">", AgeLiteral("old")),
+		Cond("text", "~", StringLiteral("a\\")),
+		Cond("text", "~", StringLiteral("(")),
+		Cond("following", ">", NumberLiteral(3)),
+		Cond("likes", "~", NumberLiteral(3)),
+		Cond("hour", "in", NumberLiteral(3)),
+		Cond("hour", "in", RangeLiteral(NumberLiteral(3), WeekdayLiteral(time.Monday))),
+	}
+
+	for _, node := range invalid {
+		_, err := FromAST(node)
+		if err == nil {
+			t.Errorf("Expected an error for AST: %+v", node)
+		}
+	}
+}
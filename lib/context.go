@@ -0,0 +1,54 @@
+package histweet
+
+import (
+	"time"
+)
+
+// Account holds information about the account whose tweets are evaluated
+type Account struct {
+	ID         int64  `json:"id"`
+	ScreenName string `json:"screen_name"`
+	Followers  int    `json:"followers"`
+}
+
+// EvalContext holds everything besides the tweet itself that a rule depends
+// on. Evaluating a rule against the same tweet and context always gives the
+// same result.
+//
+// A nil context is equivalent to the zero EvalContext.
+type EvalContext struct {
+	// Time that ages are relative to. If zero, the current time is used.
+	Now time.Time
+
+	// Location used for dates and datetimes without a time zone. If nil, UTC
+	// is used.
+	Location *time.Location
+
+	// Account that posted the tweets, if known. Conditions on "followers"
+	// and "is_thread" never match without an account.
+	//
+	// Thread context is derived from the account: a tweet is part of a
+	// thread if it replies to the account itself. Since tweets are evaluated
+	// one at a time as they are fetched, the first tweet of a thread is not
+	// known to be part of it until its replies are seen, so it is not
+	// matched.
+	Account *Account
+}
+
+// Returns a copy of this context with all defaults filled in
+func (ctx *EvalContext) resolve() *EvalContext {
+	resolved := EvalContext{}
+	if ctx != nil {
+		resolved = *ctx
+	}
+
+	if resolved.Now.IsZero() {
+		resolved.Now = time.Now()
+	}
+
+	if resolved.Location == nil {
+		resolved.Location = time.UTC
+	}
+
+	return &resolved
+}
@@ -0,0 +1,136 @@
+package histweet
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEvalContext(t *testing.T) {
+	now := time.Date(2020, 7, 2, 12, 0, 0, 0, time.UTC)
+	tweet := &Tweet{CreatedAt: time.Date(2020, 7, 1, 23, 0, 0, 0, time.UTC), NumLikes: 1}
+
+	var inputs = []struct {
+		rule     string
+		ctx      *EvalContext
+		expected bool
+	}{
+		{"age > 12h", &EvalContext{Now: now}, true},
+		{"age > 1d", &EvalContext{Now: now}, false},
+		{"age > 1d", &EvalContext{Now: now.AddDate(0, 0, 1)}, true},
+		{"created == 2020-07-01", nil, true},
+		{"created == 2020-07-01", &EvalContext{Location: time.FixedZone("CEST", 2*60*60)}, false},
+		{"followers > 100", nil, false},
+		{"followers > 100", &EvalContext{Account: &Account{Followers: 101}}, true},
+		{"!(followers > 100)", &EvalContext{Account: &Account{Followers: 100}}, true},
+	}
+
+	for _, input := range inputs {
+		t.Run(input.rule, func(t *testing.T) {
+			rule, err := Parse(input.rule)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if rule.Eval(input.ctx, tweet) != input.expected {
+				t.Errorf("Expected %v in context %+v", input.expected, input.ctx)
+			}
+
+			if rule.Explain(input.ctx, tweet).Result != input.expected {
+				t.Errorf("Explanation does not match Eval in context %+v", input.ctx)
+			}
+		})
+	}
+
+	// All tweets in an archive are evaluated against the same context
+	rule, err := Parse("age < 1d")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opts := &FetchOptions{Context: &EvalContext{Now: time.Date(2020, 7, 2, 12, 0, 0, 0, time.UTC)}}
+
+	tweets, err := FetchArchiveTweets(&Rule{Tweet: rule}, opts, "sample_archive.js")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(tweets) != 1 {
+		t.Errorf("Expected 1 tweet to match, got %d", len(tweets))
+	}
+}
+
+func TestEvalContextThreads(t *testing.T) {
+	account := &Account{ID: 42}
+
+	selfReply := &Tweet{IsReply: true, InReplyToStatusID: 1, InReplyToUserID: 42}
+	otherReply := &Tweet{IsReply: true, InReplyToStatusID: 2, InReplyToUserID: 7}
+	notReply := &Tweet{}
+
+	var inputs = []struct {
+		rule     string
+		tweet    *Tweet
+		ctx      *EvalContext
+		expected bool
+	}{
+		{"is_thread == true", selfReply, &EvalContext{Account: account}, true},
+		{"is_thread == true", otherReply, &EvalContext{Account: account}, false},
+		{"is_thread == true", notReply, &EvalContext{Account: account}, false},
+		{"is_reply == true && is_thread == false", otherReply, &EvalContext{Account: account}, true},
+		{"is_reply == true && is_thread == false", selfReply, &EvalContext{Account: account}, false},
+		{"is_thread != true", notReply, &EvalContext{Account: account}, true},
+		{"is_thread == true", selfReply, nil, false},
+		{"is_thread == false", notReply, nil, false},
+	}
+
+	for _, input := range inputs {
+		t.Run(input.rule, func(t *testing.T) {
+			rule, err := Parse(input.rule)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if rule.Eval(input.ctx, input.tweet) != input.expected {
+				t.Errorf("Expected %v for tweet %+v in context %+v", input.expected, input.tweet, input.ctx)
+			}
+
+			if rule.Explain(input.ctx, input.tweet).Result != input.expected {
+				t.Errorf("Explanation does not match Eval in context %+v", input.ctx)
+			}
+		})
+	}
+}
+
+func TestRuleNeedsAccount(t *testing.T) {
+	var inputs = []struct {
+		rule     string
+		expected bool
+	}{
+		{"likes > 3", false},
+		{"followers > 100", true},
+		{"likes > 3 && !(age > 1d || followers < 10)", true},
+		{`text contains "followers"`, false},
+		{"is_reply == true && is_thread == false", true},
+	}
+
+	for _, input := range inputs {
+		t.Run(input.rule, func(t *testing.T) {
+			parsed, err := Parse(input.rule)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if (&Rule{Tweet: parsed}).NeedsAccount() != input.expected {
+				t.Errorf("Expected NeedsAccount to be %v", input.expected)
+			}
+
+			named := &Rule{Named: []*NamedRule{{Name: "a", Rule: parsed}}}
+			if named.NeedsAccount() != input.expected {
+				t.Errorf("Expected NeedsAccount to be %v for a named rule", input.expected)
+			}
+		})
+	}
+
+	if (&Rule{Count: &RuleCount{N: 3}}).NeedsAccount() {
+		t.Errorf("Expected a count rule not to need an account")
+	}
+}
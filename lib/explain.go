@@ -0,0 +1,185 @@
+package histweet
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// Maximum length of a tweet's text shown in an Explanation
+	explainExcerptLength = 40
+)
+
+// Explanation is the evaluation trace of a rule (or a part of it) against a
+// single tweet.
+//
+// Chains of the same logical operator are flattened, so "a && b && c" has
+// three children. A child decided the result of its parent if both have the
+// same result: e.g., any false child of a false "&&".
+type Explanation struct {
+	// The (sub-)expression that was evaluated, formatted by Format
+	Expr string `json:"expr"`
+
+	// Whether the tweet matched the expression
+	Result bool `json:"result"`
+
+	// For conditions, the value of the tweet's field
+	Value string `json:"value,omitempty"`
+
+	Children []*Explanation `json:"children,omitempty"`
+}
+
+// Returns the value of the given field for a tweet, as shown in an
+// Explanation
+func explainValue(ctx *EvalContext, tweet *Tweet, field string) string {
+	switch field {
+	case "age", "created":
+		return tweet.CreatedAt.Format(time.RFC3339)
+	case "text":
+		return strconv.Quote(tweet.Excerpt(explainExcerptLength))
+	case "likes":
+		return strconv.Itoa(tweet.NumLikes)
+	case "retweets":
+		return strconv.Itoa(tweet.NumRetweets)
+	case "replies":
+		return strconv.Itoa(tweet.NumReplies)
+	case "quotes":
+		return strconv.Itoa(tweet.NumQuotes)
+	case "engagement":
+		return strconv.Itoa(tweet.Engagement())
+	case "hour":
+		return strconv.Itoa(tweet.CreatedAt.In(ctx.Location).Hour())
+	case "weekday":
+		return strings.ToLower(tweet.CreatedAt.In(ctx.Location).Weekday().String()[:3])
+	case "followers":
+		if ctx.Account == nil {
+			return "unknown"
+		}
+
+		return strconv.Itoa(ctx.Account.Followers)
+	case "is_thread":
+		if ctx.Account == nil {
+			return "unknown"
+		}
+
+		return strconv.FormatBool(tweet.attribute(ctx, attributeThread))
+	default:
+		if attr, ok := attributeIdents[field]; ok {
+			return strconv.FormatBool(tweet.attribute(ctx, attr))
+		}
+
+		return ""
+	}
+}
+
+// Collects the operands of a chain of the same logical operator
+func logicalOperands(node *parseNode, op tokenKind) []*parseNode {
+	if node.kind != nodeLogical || node.op != op {
+		return []*parseNode{node}
+	}
+
+	return append(logicalOperands(node.left, op), logicalOperands(node.right, op)...)
+}
+
+func explainInternal(ctx *EvalContext, tweet *Tweet, node *parseNode) *Explanation {
+	explanation := &Explanation{
+		Expr: FormatNode(toAST(node)),
+	}
+
+	switch node.kind {
+	case nodeCond:
+		explanation.Result = tweet.isMatch(ctx, node.rule)
+		explanation.Value = explainValue(ctx, tweet, node.ident)
+	case nodeLogical:
+		for _, operand := range logicalOperands(node, node.op) {
+			explanation.Children = append(explanation.Children, explainInternal(ctx, tweet, operand))
+		}
+
+		// "&&" is true unless any operand is false, "||" is false unless any
+		// operand is true
+		explanation.Result = node.op == tokenAnd
+
+		for _, child := range explanation.Children {
+			if child.Result != (node.op == tokenAnd) {
+				explanation.Result = child.Result
+			}
+		}
+	case nodeNot:
+		child := explainInternal(ctx, tweet, node.left)
+
+		explanation.Result = !child.Result
+		explanation.Children = []*Explanation{child}
+	default:
+		panic(fmt.Sprintf("Unexpected node type: %d", node.kind))
+	}
+
+	return explanation
+}
+
+// Explain evaluates this rule against the given tweet in the given context,
+// like Eval, and returns the full evaluation trace
+func (rule *ParsedRule) Explain(ctx *EvalContext, tweet *Tweet) *Explanation {
+	return explainInternal(ctx.resolve(), tweet, rule.root)
+}
+
+// Explain returns the evaluation trace of the tweet-based rule that applies
+// to the given tweet: either the rule string, or the named rule that matched
+// the tweet (or the first named rule, if none matched). Returns nil for
+// count-based rules.
+func (rule *Rule) Explain(ctx *EvalContext, tweet *Tweet) *Explanation {
+	if rule.Tweet != nil {
+		return rule.Tweet.Explain(ctx, tweet)
+	}
+
+	if len(rule.Named) == 0 {
+		return nil
+	}
+
+	for _, named := range rule.Named {
+		if named.Name == tweet.MatchedRule {
+			return named.Rule.Explain(ctx, tweet)
+		}
+	}
+
+	return rule.Named[0].Rule.Explain(ctx, tweet)
+}
+
+func (explanation *Explanation) writeTo(output *strings.Builder, depth int, decided bool) {
+	result := "no match"
+	if explanation.Result {
+		result = "match"
+	}
+
+	fmt.Fprintf(output, "%s%s: %s", strings.Repeat("  ", depth), result, explanation.Expr)
+
+	if explanation.Value != "" {
+		fmt.Fprintf(output, " (value: %s)", explanation.Value)
+	}
+
+	if decided {
+		output.WriteString(" <- decided")
+	}
+
+	output.WriteString("\n")
+
+	// Only point out which children decided the result if some did not
+	allDecided := true
+
+	for _, child := range explanation.Children {
+		allDecided = allDecided && child.Result == explanation.Result
+	}
+
+	for _, child := range explanation.Children {
+		child.writeTo(output, depth+1, !allDecided && child.Result == explanation.Result)
+	}
+}
+
+// String renders the trace as an indented tree, with one line per
+// (sub-)expression
+func (explanation *Explanation) String() string {
+	var output strings.Builder
+	explanation.writeTo(&output, 0, false)
+	return output.String()
+}
@@ -0,0 +1,77 @@
+package histweet
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExplain(t *testing.T) {
+	rule, err := Parse("likes < 3 && retweets < 3 && !(text ~ \"pinned\" || is_reply == true)")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tweets := []Tweet{
+		{Text: "hello", NumLikes: 1},
+		{Text: "pinned", NumLikes: 1},
+		{Text: "hello", NumLikes: 1, NumRetweets: 5, IsReply: true},
+	}
+
+	for i := range tweets {
+		explanation := rule.Explain(nil, &tweets[i])
+		if explanation.Result != rule.Eval(nil, &tweets[i]) {
+			t.Errorf("Explanation result for tweet %d does not match Eval", i)
+		}
+	}
+
+	explanation := rule.Explain(nil, &tweets[1])
+
+	// The "&&" chain is flattened
+	if len(explanation.Children) != 3 {
+		t.Fatalf("Explanation has %d children, expected 3", len(explanation.Children))
+	}
+
+	likes := explanation.Children[0]
+	if !likes.Result || likes.Expr != "likes < 3" || likes.Value != "1" {
+		t.Errorf("Unexpected explanation for likes: %+v", likes)
+	}
+
+	not := explanation.Children[2]
+	if not.Result || len(not.Children) != 1 || !not.Children[0].Result {
+		t.Errorf("Unexpected explanation for negation: %+v", not)
+	}
+
+	expected := `no match: likes < 3 && retweets < 3 && !(text ~ "pinned" || is_reply == true)
+  match: likes < 3 (value: 1)
+  match: retweets < 3 (value: 0)
+  no match: !(text ~ "pinned" || is_reply == true) <- decided
+    match: text ~ "pinned" || is_reply == true
+      match: text ~ "pinned" (value: "pinned") <- decided
+      no match: is_reply == true (value: false)
+`
+
+	if s := explanation.String(); s != expected {
+		t.Errorf("Unexpected explanation:\n%s\nExpected:\n%s", s, expected)
+	}
+
+	// Named rules are explained by the rule that matched
+	named, err := ParseRules("popular: likes > 100\nunpopular: likes < 3")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	combined := &Rule{Named: named}
+	tweet := Tweet{NumLikes: 1}
+
+	if !combined.Match(nil, &tweet) {
+		t.Fatalf("Expected tweet to match")
+	}
+
+	if s := combined.Explain(nil, &tweet).String(); !strings.HasPrefix(s, "match: likes < 3") {
+		t.Errorf("Unexpected explanation for named rule: %s", s)
+	}
+
+	if (&Rule{Count: &RuleCount{N: 3}}).Explain(nil, &tweet) != nil {
+		t.Errorf("Expected no explanation for a count rule")
+	}
+}
@@ -0,0 +1,159 @@
+package histweet
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Supported export formats
+const (
+	ExportCSV  = "csv"
+	ExportJSON = "json"
+)
+
+// Header row of a CSV export
+var exportCSVHeader = []string{
+	"id",
+	"created_at",
+	"text",
+	"likes",
+	"retweets",
+	"replies",
+	"quotes",
+	"is_retweet",
+	"is_reply",
+	"is_quote",
+	"has_media",
+	"has_link",
+	"matched_rule",
+}
+
+// A single tweet in a JSON export
+type exportedTweet struct {
+	ID          int64     `json:"id"`
+	CreatedAt   time.Time `json:"created_at"`
+	Text        string    `json:"text"`
+	NumLikes    int       `json:"likes"`
+	NumRetweets int       `json:"retweets"`
+	NumReplies  int       `json:"replies"`
+	NumQuotes   int       `json:"quotes"`
+	IsRetweet   bool      `json:"is_retweet"`
+	IsReply     bool      `json:"is_reply"`
+	IsQuote     bool      `json:"is_quote"`
+	HasMedia    bool      `json:"has_media"`
+	HasLink     bool      `json:"has_link"`
+	MatchedRule string    `json:"matched_rule,omitempty"`
+}
+
+// ExportFormat returns the export format for the given path, based on its
+// file extension
+func ExportFormat(path string) (string, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		return ExportCSV, nil
+	case ".json":
+		return ExportJSON, nil
+	default:
+		return "", fmt.Errorf("Unsupported export file %s - must end in .csv or .json", path)
+	}
+}
+
+// WriteTweetsCSV writes the given tweets as CSV, including a header row
+func WriteTweetsCSV(w io.Writer, tweets []Tweet) error {
+	writer := csv.NewWriter(w)
+
+	err := writer.Write(exportCSVHeader)
+	if err != nil {
+		return err
+	}
+
+	for _, tweet := range tweets {
+		record := []string{
+			strconv.FormatInt(tweet.ID, 10),
+			tweet.CreatedAt.Format(time.RFC3339),
+			tweet.Text,
+			strconv.Itoa(tweet.NumLikes),
+			strconv.Itoa(tweet.NumRetweets),
+			strconv.Itoa(tweet.NumReplies),
+			strconv.Itoa(tweet.NumQuotes),
+			strconv.FormatBool(tweet.IsRetweet),
+			strconv.FormatBool(tweet.IsReply),
+			strconv.FormatBool(tweet.IsQuote),
+			strconv.FormatBool(tweet.HasMedia),
+			strconv.FormatBool(tweet.HasLink),
+			tweet.MatchedRule,
+		}
+
+		err = writer.Write(record)
+		if err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+
+	return writer.Error()
+}
+
+// WriteTweetsJSON writes the given tweets as a JSON array
+func WriteTweetsJSON(w io.Writer, tweets []Tweet) error {
+	exported := make([]exportedTweet, 0, len(tweets))
+
+	for _, tweet := range tweets {
+		exported = append(exported, exportedTweet{
+			ID:          tweet.ID,
+			CreatedAt:   tweet.CreatedAt,
+			Text:        tweet.Text,
+			NumLikes:    tweet.NumLikes,
+			NumRetweets: tweet.NumRetweets,
+			NumReplies:  tweet.NumReplies,
+			NumQuotes:   tweet.NumQuotes,
+			IsRetweet:   tweet.IsRetweet,
+			IsReply:     tweet.IsReply,
+			IsQuote:     tweet.IsQuote,
+			HasMedia:    tweet.HasMedia,
+			HasLink:     tweet.HasLink,
+			MatchedRule: tweet.MatchedRule,
+		})
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+
+	return encoder.Encode(exported)
+}
+
+// ExportTweets writes the given tweets to a file at the given path. The
+// format (CSV or JSON) is determined by the file extension.
+func ExportTweets(tweets []Tweet, path string) error {
+	format, err := ExportFormat(path)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	switch format {
+	case ExportCSV:
+		err = WriteTweetsCSV(f, tweets)
+	case ExportJSON:
+		err = WriteTweetsJSON(f, tweets)
+	}
+
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
@@ -0,0 +1,95 @@
+package histweet
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestExportTweets(t *testing.T) {
+	tweets := []Tweet{
+		{
+			ID:          123,
+			CreatedAt:   time.Date(2020, 5, 10, 12, 0, 0, 0, time.UTC),
+			Text:        "Hello, \"world\"!\nBye.",
+			NumLikes:    2,
+			IsReply:     true,
+			MatchedRule: "unpopular",
+		},
+		{
+			ID:          456,
+			Text:        "Just text",
+			NumRetweets: 10,
+			HasLink:     true,
+		},
+	}
+
+	dir, err := ioutil.TempDir("", "histweet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// CSV
+	path := filepath.Join(dir, "tweets.csv")
+
+	err = ExportTweets(tweets, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	records, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(records) != 3 {
+		t.Fatalf("CSV export has %d records, expected 3", len(records))
+	}
+
+	first := records[1]
+	if first[0] != "123" || first[1] != "2020-05-10T12:00:00Z" || first[2] != tweets[0].Text ||
+		first[3] != "2" || first[8] != "true" || first[12] != "unpopular" {
+		t.Errorf("Unexpected CSV record: %v", first)
+	}
+
+	// JSON
+	path = filepath.Join(dir, "tweets.JSON")
+
+	err = ExportTweets(tweets, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var exported []exportedTweet
+
+	err = json.Unmarshal(buf, &exported)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(exported) != 2 || exported[1].ID != 456 || exported[1].NumRetweets != 10 || !exported[1].HasLink {
+		t.Errorf("Unexpected JSON export: %+v", exported)
+	}
+
+	// Unsupported format
+	err = ExportTweets(tweets, filepath.Join(dir, "tweets.txt"))
+	if err == nil {
+		t.Errorf("Expected an error for an unsupported export format")
+	}
+}
@@ -0,0 +1,107 @@
+package histweet
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Returns the binding strength of the given node type. Higher binds tighter.
+func nodePrecedence(typ NodeType) int {
+	switch typ {
+	case NodeOr:
+		return 1
+	case NodeAnd:
+		return 2
+	case NodeNot:
+		return 3
+	default:
+		return 4
+	}
+}
+
+// Formats a literal as it would appear in a rule string
+func formatLiteral(literal *Literal) string {
+	switch literal.Type {
+	case LiteralString:
+		return quoteString(literal.Value) + literal.Flags
+	case LiteralAge:
+		// Units are always listed from largest to smallest
+		if units, err := parseAge(literal.Value); err == nil {
+			return units.String()
+		}
+	case LiteralRange:
+		if token, err := literal.token(); err == nil {
+			if from, to, err := splitRange(token); err == nil {
+				return RangeLiteral(*newLiteral(from), *newLiteral(to)).Value
+			}
+		}
+	}
+
+	return literal.Value
+}
+
+func formatNode(node *Node, output *strings.Builder) {
+	switch node.Type {
+	case NodeCond:
+		fmt.Fprintf(output, "%s %s %s", node.Field, node.Operator, formatLiteral(node.Literal))
+	case NodeNot:
+		output.WriteString("!")
+
+		// Parens are not needed around a negated condition, but without them
+		// "!likes > 3" reads as if only the field was negated
+		child := node.Children[0]
+		if child.Type == NodeCond {
+			output.WriteString("(")
+			formatNode(child, output)
+			output.WriteString(")")
+		} else {
+			formatChild(child, nodePrecedence(NodeNot), false, output)
+		}
+	case NodeAnd, NodeOr:
+		op := " && "
+		if node.Type == NodeOr {
+			op = " || "
+		}
+
+		for i, child := range node.Children {
+			if i > 0 {
+				output.WriteString(op)
+			}
+
+			formatChild(child, nodePrecedence(node.Type), i > 0, output)
+		}
+	}
+}
+
+// Formats a child of a node with the given precedence, adding parens only if
+// they are needed to preserve the structure of the tree. Since "&&" and "||"
+// are left-associative, the right operand needs parens if it binds as loosely
+// as its parent.
+func formatChild(child *Node, parent int, isRight bool, output *strings.Builder) {
+	prec := nodePrecedence(child.Type)
+	needsParens := prec < parent || (isRight && prec == parent)
+
+	if needsParens {
+		output.WriteString("(")
+	}
+
+	formatNode(child, output)
+
+	if needsParens {
+		output.WriteString(")")
+	}
+}
+
+// FormatNode renders the given AST as a rule string
+func FormatNode(node *Node) string {
+	var output strings.Builder
+	formatNode(node, &output)
+	return output.String()
+}
+
+// Format renders the given rule as a canonical rule string, with single spaces
+// around operators and only the parens required by operator precedence, plus
+// parens around negated conditions. Parsing the result yields the same rule.
+func Format(rule *ParsedRule) string {
+	return FormatNode(rule.AST())
+}
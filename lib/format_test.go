@@ -0,0 +1,118 @@
+package histweet
+
+import (
+	"testing"
+)
+
+func TestFormat(t *testing.T) {
+	var inputs = []struct {
+		input    string
+		expected string
+	}{
+		{"likes>3", "likes > 3"},
+		{"(likes > 3)", "likes > 3"},
+		{"((likes > 3 && retweets < 2))", "likes > 3 && retweets < 2"},
+		{"likes > 3 && retweets < 2 || replies == 0", "likes > 3 && retweets < 2 || replies == 0"},
+		{"(likes > 3 || retweets < 2) && replies == 0", "(likes > 3 || retweets < 2) && replies == 0"},
+		{"likes > 3 || (retweets < 2 && replies == 0)", "likes > 3 || retweets < 2 && replies == 0"},
+		{"likes > 3 || (retweets < 2 || replies == 0)", "likes > 3 || (retweets < 2 || replies == 0)"},
+		{"(likes > 3 || retweets < 2) || replies == 0", "likes > 3 || retweets < 2 || replies == 0"},
+		{"! (likes > 3)", "!(likes > 3)"},
+		{"!likes > 3 && !(retweets < 2)", "!(likes > 3) && !(retweets < 2)"},
+		{"!(likes > 3 && retweets < 2)", "!(likes > 3 && retweets < 2)"},
+		{"!!(text ~ \"a b\")", "!!(text ~ \"a b\")"},
+		{"!(!(likes > 3) || age > 1y)", "!(!(likes > 3) || age > 1y)"},
+		{"age   >\n 1y3d && created <= 10-May-2020", "age > 1y3d && created <= 10-May-2020"},
+		{"age > 30min1d || age < 3d1y2w", "age > 1d30min || age < 1y2w3d"},
+		{"created in [2019-01-01,10-May-2020]", "created in [2019-01-01, 10-May-2020]"},
+		{"hour in [ 22,2 ] && weekday in [sat,  sun]", "hour in [22, 2] && weekday in [sat, sun]"},
+		{"created>=2020-05-10T14:00Z", "created >= 2020-05-10T14:00Z"},
+		{"is_retweet == true && has_media != false", "is_retweet == true && has_media != false"},
+		{"text contains \"a\"i||text   word \"b\"", "text contains \"a\"i || text word \"b\""},
+		{`text contains "say \"hi\""  ||text ~ "\d+"`, `text contains "say \"hi\"" || text ~ "\d+"`},
+	}
+
+	for _, input := range inputs {
+		t.Run(input.input, func(t *testing.T) {
+			rule, err := Parse(input.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			formatted := Format(rule)
+			if formatted != input.expected {
+				t.Errorf("Formatted rule %q != expected %q", formatted, input.expected)
+			}
+
+			// The formatted rule must parse to the same tree
+			reparsed, err := Parse(formatted)
+			if err != nil {
+				t.Fatalf("Failed to parse formatted rule: %s", err)
+			}
+
+			if FormatNode(reparsed.AST()) != formatted {
+				t.Errorf("Formatted rule did not round trip: %q", formatted)
+			}
+		})
+	}
+
+	// Children of n-ary AST nodes that bind as loosely as their parent need
+	// parens to preserve the tree
+	node := And(
+		Cond("likes", ">", NumberLiteral(1)),
+		And(Cond("likes", ">", NumberLiteral(2)), Cond("likes", ">", NumberLiteral(3))),
+		Or(Cond("likes", ">", NumberLiteral(4)), Cond("likes", ">", NumberLiteral(5))),
+	)
+
+	expected := "likes > 1 && (likes > 2 && likes > 3) && (likes > 4 || likes > 5)"
+	if formatted := FormatNode(node); formatted != expected {
+		t.Errorf("Formatted AST %q != expected %q", formatted, expected)
+	}
+}
+
+func TestFormatRules(t *testing.T) {
+	input := `# Header comment
+
+unpopular:   age > 30d &&
+   # Only if nobody liked it
+   (likes < 3)   # Trailing
+
+
+# Typos
+typos: text ~ "#teh"  # Embarrassing
+`
+
+	expected := `# Header comment
+
+# Only if nobody liked it
+unpopular: age > 30d && likes < 3  # Trailing
+
+
+# Typos
+typos: text ~ "#teh"  # Embarrassing
+`
+
+	formatted, err := FormatRules(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if formatted != expected {
+		t.Errorf("Formatted rules:\n%s\nExpected:\n%s", formatted, expected)
+	}
+
+	// Formatting is idempotent
+	again, err := FormatRules(formatted)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if again != formatted {
+		t.Errorf("Formatting is not idempotent:\n%s", again)
+	}
+
+	_, err = FormatRules("a: likes >")
+	if err == nil {
+		t.Errorf("Expected an error for an invalid rules file")
+	}
+}
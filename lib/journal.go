@@ -0,0 +1,132 @@
+package histweet
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Journal is a persistent, append-only log of deleted tweets.
+//
+// Each successfully deleted tweet ID is appended to the journal file on its
+// own line. If a long deletion run is interrupted, the journal can be used to
+// skip all tweets that were already deleted when the run is restarted.
+//
+// A Journal is safe for concurrent use.
+type Journal struct {
+	f       *os.File
+	deleted map[int64]bool
+	mu      sync.Mutex
+}
+
+// OpenJournal opens the journal at the given path, creating it if needed,
+// and loads all previously recorded tweet IDs
+func OpenJournal(path string) (*Journal, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	journal := &Journal{
+		f:       f,
+		deleted: make(map[int64]bool),
+	}
+
+	err = journal.load()
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("Invalid journal %s: %w", path, err)
+	}
+
+	return journal, nil
+}
+
+// Reads all recorded IDs from the journal file
+func (journal *Journal) load() error {
+	reader := bufio.NewReader(journal.f)
+
+	// Size of all complete lines read so far
+	var size int64
+
+	for {
+		line, err := reader.ReadString('\n')
+		if err == io.EOF {
+			if line != "" {
+				// The last write was interrupted, so the last ID is incomplete.
+				// Drop it to ensure that the next ID starts on a new line.
+				return journal.f.Truncate(size)
+			}
+
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		size += int64(len(line))
+
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		id, err := strconv.ParseInt(line, 10, 64)
+		if err != nil {
+			return err
+		}
+
+		journal.deleted[id] = true
+	}
+}
+
+// Contains returns true if the given tweet ID was recorded in the journal
+func (journal *Journal) Contains(id int64) bool {
+	journal.mu.Lock()
+	defer journal.mu.Unlock()
+
+	return journal.deleted[id]
+}
+
+// Len returns the number of tweet IDs recorded in the journal
+func (journal *Journal) Len() int {
+	journal.mu.Lock()
+	defer journal.mu.Unlock()
+
+	return len(journal.deleted)
+}
+
+// Record appends the given tweet ID to the journal
+func (journal *Journal) Record(id int64) error {
+	journal.mu.Lock()
+	defer journal.mu.Unlock()
+
+	_, err := fmt.Fprintf(journal.f, "%d\n", id)
+	if err != nil {
+		return err
+	}
+
+	journal.deleted[id] = true
+
+	return nil
+}
+
+// Remaining returns all tweets that have not been recorded in the journal
+func (journal *Journal) Remaining(tweets []Tweet) []Tweet {
+	remaining := make([]Tweet, 0, len(tweets))
+
+	for _, tweet := range tweets {
+		if !journal.Contains(tweet.ID) {
+			remaining = append(remaining, tweet)
+		}
+	}
+
+	return remaining
+}
+
+// Close closes the journal file
+func (journal *Journal) Close() error {
+	return journal.f.Close()
+}
@@ -0,0 +1,114 @@
+package histweet
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/dghubble/go-twitter/twitter"
+)
+
+// Mock Twitter client that keeps track of all destroyed tweets
+type countingTwitterStatusService struct {
+	destroyed []int64
+	mu        sync.Mutex
+}
+
+func (s *countingTwitterStatusService) Destroy(id int64, params *twitter.StatusDestroyParams) (*twitter.Tweet, *http.Response, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.destroyed = append(s.destroyed, id)
+
+	return nil, nil, nil
+}
+
+type countingTwitterClient struct {
+	mockTwitterClient
+	status *countingTwitterStatusService
+}
+
+func (t *countingTwitterClient) statusService() twitterStatusService {
+	return t.status
+}
+
+func TestJournal(t *testing.T) {
+	dir, err := ioutil.TempDir("", "histweet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "journal")
+
+	journal, err := OpenJournal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := &countingTwitterClient{status: &countingTwitterStatusService{}}
+	tweets := []Tweet{{ID: 1}, {ID: 2}, {ID: 3}}
+
+	_, err = DeleteTweets(tweets[:2], client, &DeleteOptions{Journal: journal})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	journal.Close()
+
+	// Simulate an interrupted write at the end of the journal
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f.WriteString("12")
+	f.Close()
+
+	// Re-open the journal and resume deletion
+	journal, err = OpenJournal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if journal.Len() != 2 || !journal.Contains(1) || !journal.Contains(2) || journal.Contains(12) {
+		t.Errorf("Unexpected journal contents after re-opening")
+	}
+
+	remaining := journal.Remaining(tweets)
+	if len(remaining) != 1 || remaining[0].ID != 3 {
+		t.Errorf("Unexpected remaining tweets: %v", remaining)
+	}
+
+	_, err = DeleteTweets(tweets, client, &DeleteOptions{Journal: journal})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	journal.Close()
+
+	// Each tweet should have been destroyed exactly once
+	destroyed := client.status.destroyed
+	if len(destroyed) != 3 || destroyed[0] != 1 || destroyed[1] != 2 || destroyed[2] != 3 {
+		t.Errorf("Unexpected destroyed tweets: %v", destroyed)
+	}
+
+	journal, err = OpenJournal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer journal.Close()
+
+	if journal.Len() != 3 {
+		t.Errorf("Journal has %d tweets, expected 3", journal.Len())
+	}
+
+	// Invalid journal
+	_, err = OpenJournal("sample_archive.js")
+	if err == nil {
+		t.Errorf("Expected an error for an invalid journal")
+	}
+}
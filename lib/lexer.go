@@ -1,10 +1,10 @@
 package histweet
 
 import (
-	"fmt"
 	"math"
 	"regexp"
 	"strings"
+	"unicode"
 )
 
 type tokenKind int
@@ -16,6 +16,9 @@ const (
 	tokenString
 	tokenAge
 	tokenTime
+	tokenBool
+	tokenWeekday
+	tokenRange
 
 	// Grouping
 	tokenLparen
@@ -34,8 +37,17 @@ const (
 	tokenNeq
 	tokenIn
 	tokenNotIn
+	tokenContains
+	tokenWord
+	tokenStartsWith
+	tokenEndsWith
+	tokenInRange
+
+	// Unary operators
+	tokenNot
 
 	tokenEOF
+	tokenInvalid
 )
 
 func (t tokenKind) ToString() string {
@@ -50,6 +62,12 @@ func (t tokenKind) ToString() string {
 		return "age"
 	case tokenTime:
 		return "time"
+	case tokenBool:
+		return "bool"
+	case tokenWeekday:
+		return "weekday"
+	case tokenRange:
+		return "range"
 	case tokenLparen:
 		return "left paren"
 	case tokenRparen:
@@ -74,8 +92,22 @@ func (t tokenKind) ToString() string {
 		return "in"
 	case tokenNotIn:
 		return "not in"
+	case tokenContains:
+		return "contains"
+	case tokenWord:
+		return "word"
+	case tokenStartsWith:
+		return "starts with"
+	case tokenEndsWith:
+		return "ends with"
+	case tokenInRange:
+		return "in range"
+	case tokenNot:
+		return "not"
 	case tokenEOF:
 		return "eof"
+	case tokenInvalid:
+		return "invalid"
 	default:
 		return "unknown"
 	}
@@ -86,6 +118,10 @@ type token struct {
 	val  string
 	pos  int
 	size int
+
+	// Line and column of the token in the input (1-indexed)
+	line int
+	col  int
 }
 
 type lexer struct {
@@ -98,7 +134,7 @@ type lexer struct {
 func newLexer(tokens map[tokenKind]string, input string) *lexer {
 	lexer := &lexer{
 		patterns:  make(map[tokenKind]*regexp.Regexp),
-		input:     strings.TrimSpace(input),
+		input:     strings.TrimRightFunc(input, unicode.IsSpace),
 		pos:       0,
 		numTokens: 0,
 	}
@@ -118,18 +154,17 @@ func (lex *lexer) peekToken() (*token, error) {
 
 	if lex.pos >= len(lex.input) {
 		// Reached the end of the input
+		token.line, token.col = lineAndCol(lex.input, token.pos)
 		return token, nil
 	}
 
 	matchPos := []int{math.MaxInt32, 0}
 	matchType := tokenEOF
 
-	// Consume any whitespace characters in the input
-	for {
-		if lex.input[lex.pos] != ' ' {
-			break
-		}
-
+	// Consume any whitespace characters in the input, including newlines.
+	// Trailing whitespace is trimmed from the input, so there is always
+	// a non-whitespace character left at this point.
+	for unicode.IsSpace(rune(lex.input[lex.pos])) {
 		lex.pos++
 	}
 
@@ -154,11 +189,23 @@ func (lex *lexer) peekToken() (*token, error) {
 			// Always select the token with the _longest_ match
 			matchType = k
 			matchPos = location
+		} else if location[0] == matchPos[0] && tmpMatchLen == currMatchLen && matchType == tokenIdent {
+			// Keywords (e.g., "true") also match as identifiers, so
+			// prefer the keyword token in case of a tie
+			matchType = k
+			matchPos = location
 		}
 	}
 
 	if matchType == tokenEOF {
-		return nil, fmt.Errorf("No match found at position %d", lex.pos)
+		// Report the offending character as an invalid token
+		token.kind = tokenInvalid
+		token.pos = lex.pos
+		token.size = 1
+		token.val = lex.input[lex.pos : lex.pos+1]
+		token.line, token.col = lineAndCol(lex.input, token.pos)
+
+		return nil, newParserError("No valid token found", token)
 	}
 
 	start, end := matchPos[0], matchPos[1]
@@ -169,6 +216,7 @@ func (lex *lexer) peekToken() (*token, error) {
 	token.pos = lex.pos + start
 	token.size = matchLen
 	token.val = strings.TrimSpace(lex.input[token.pos : token.pos+matchLen])
+	token.line, token.col = lineAndCol(lex.input, token.pos)
 
 	return token, nil
 }
@@ -64,6 +64,73 @@ func TestLexer(t *testing.T) {
 			token{kind: tokenNotIn, val: "!~"},
 			token{kind: tokenString, val: `"xyz"`},
 		},
+		"!(likes != 3)": {
+			token{kind: tokenNot, val: "!"},
+			token{kind: tokenLparen, val: "("},
+			token{kind: tokenIdent, val: "likes"},
+			token{kind: tokenNeq, val: "!="},
+			token{kind: tokenNumber, val: "3"},
+			token{kind: tokenRparen, val: ")"},
+		},
+		"is_retweet == true && has_link != false": {
+			token{kind: tokenIdent, val: "is_retweet"},
+			token{kind: tokenEq, val: "=="},
+			token{kind: tokenBool, val: "true"},
+			token{kind: tokenAnd, val: "&&"},
+			token{kind: tokenIdent, val: "has_link"},
+			token{kind: tokenNeq, val: "!="},
+			token{kind: tokenBool, val: "false"},
+		},
+		"text contains \"abc\"i || text startswith \"RT\" || contained word \"a\"": {
+			token{kind: tokenIdent, val: "text"},
+			token{kind: tokenContains, val: "contains"},
+			token{kind: tokenString, val: `"abc"i`},
+			token{kind: tokenOr, val: "||"},
+			token{kind: tokenIdent, val: "text"},
+			token{kind: tokenStartsWith, val: "startswith"},
+			token{kind: tokenString, val: `"RT"`},
+			token{kind: tokenOr, val: "||"},
+			token{kind: tokenIdent, val: "contained"},
+			token{kind: tokenWord, val: "word"},
+			token{kind: tokenString, val: `"a"`},
+		},
+		`text ~ "say \"hi\" (\\d+)"`: {
+			token{kind: tokenIdent, val: "text"},
+			token{kind: tokenIn, val: "~"},
+			token{kind: tokenString, val: `"say \"hi\" (\\d+)"`},
+		},
+		"created >= 2020-05-10 && created < 2020-05-10T14:00:00.5+02:00": {
+			token{kind: tokenIdent, val: "created"},
+			token{kind: tokenGte, val: ">="},
+			token{kind: tokenTime, val: "2020-05-10"},
+			token{kind: tokenAnd, val: "&&"},
+			token{kind: tokenIdent, val: "created"},
+			token{kind: tokenLt, val: "<"},
+			token{kind: tokenTime, val: "2020-05-10T14:00:00.5+02:00"},
+		},
+		"age > 2h30min || age <= 1w3m": {
+			token{kind: tokenIdent, val: "age"},
+			token{kind: tokenGt, val: ">"},
+			token{kind: tokenAge, val: "2h30min"},
+			token{kind: tokenOr, val: "||"},
+			token{kind: tokenIdent, val: "age"},
+			token{kind: tokenLte, val: "<="},
+			token{kind: tokenAge, val: "1w3m"},
+		},
+		"created in [2019-01-01, 2019-06-30] || weekday == sat": {
+			token{kind: tokenIdent, val: "created"},
+			token{kind: tokenInRange, val: "in"},
+			token{kind: tokenRange, val: "[2019-01-01, 2019-06-30]"},
+			token{kind: tokenOr, val: "||"},
+			token{kind: tokenIdent, val: "weekday"},
+			token{kind: tokenEq, val: "=="},
+			token{kind: tokenWeekday, val: "sat"},
+		},
+		"trueish == falsey": {
+			token{kind: tokenIdent, val: "trueish"},
+			token{kind: tokenEq, val: "=="},
+			token{kind: tokenIdent, val: "falsey"},
+		},
 
 		// Invalid tokens
 		"age > 3m ** (likes < 100 && likes == 34)": {
@@ -124,6 +191,9 @@ func TestLexerTokenKinds(t *testing.T) {
 		tokenString,
 		tokenAge,
 		tokenTime,
+		tokenBool,
+		tokenWeekday,
+		tokenRange,
 		tokenLparen,
 		tokenRparen,
 		tokenOr,
@@ -136,7 +206,14 @@ func TestLexerTokenKinds(t *testing.T) {
 		tokenNeq,
 		tokenIn,
 		tokenNotIn,
+		tokenContains,
+		tokenWord,
+		tokenStartsWith,
+		tokenEndsWith,
+		tokenInRange,
+		tokenNot,
 		tokenEOF,
+		tokenInvalid,
 		9999,
 	}
 
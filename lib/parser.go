@@ -10,6 +10,9 @@ import (
 
 const (
 	timeLayout = "02-Jan-2006"
+
+	// Flags that may follow a string literal, as supported by regexp
+	regexpFlags = "imsU"
 )
 
 // Tokens for terminals of the Twitter rule parser grammar
@@ -20,9 +23,11 @@ const (
 var Tokens = map[tokenKind]string{
 	tokenIdent:  "^[a-zA-Z_]+",
 	tokenNumber: "^[0-9]+",
-	tokenString: `^"[^\"]*"`,
-	tokenAge:    `^\s*([0-9]+[ymd])?([0-9]+[ymd])?([0-9]+[ymd])`,
-	tokenTime:   `^\d\d-\w\w\w-\d\d\d\d`,
+	tokenString: `^"(\\.|[^"\\])*"[a-zA-Z]*`,
+	tokenAge:    `^([0-9]+(min|[ymwdhs]))+`,
+	tokenTime:   `^(\d\d-\w\w\w-\d\d\d\d|\d\d\d\d-\d\d-\d\d(T\d\d:\d\d(:\d\d(\.\d+)?)?(Z|[+-]\d\d:\d\d)?)?)`,
+	tokenBool:   `^(true|false)\b`,
+	tokenRange:  `^\[[^\[\]]*\]`,
 	tokenLparen: `^\(`,
 	tokenRparen: `^\)`,
 	tokenOr:     `^\|\|`,
@@ -35,6 +40,28 @@ var Tokens = map[tokenKind]string{
 	tokenNeq:    "^!=",
 	tokenIn:     "^~",
 	tokenNotIn:  "^!~",
+	tokenNot:    "^!",
+
+	tokenContains:   `^contains\b`,
+	tokenWord:       `^word\b`,
+	tokenStartsWith: `^startswith\b`,
+	tokenEndsWith:   `^endswith\b`,
+	tokenInRange:    `^in\b`,
+	tokenWeekday:    `^(mon|tue|wed|thu|fri|sat|sun)\b`,
+}
+
+// Matches a character that cannot be part of a word, in any script
+const nonWordChar = `[^\p{L}\p{M}\p{N}_]`
+
+// Maps weekday literals to the day they refer to
+var weekdayNames = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
 }
 
 type nodeKind int
@@ -43,14 +70,14 @@ type nodeKind int
 const (
 	nodeCond nodeKind = iota
 	nodeLogical
+	nodeNot
 )
 
 // parseNode represents a single node in the parse tree.
 //
-// Each node has a kind, which is one of: "expr", "logical", or "cond".
+// Each node has a kind, which is one of: "logical", "not", or "cond".
 // Logical nodes indicate that the node's two children are connected by a
-// logical operation (&& or ||). Expr nodes indicate one or more expressions or
-// conditions, tied by logical operators.
+// logical operation (&& or ||). Not nodes negate their only (left) child.
 //
 // If the node is a condition (cond) node, the rule field will contains the logic
 // required to evaluate a match for a given tweet.
@@ -63,6 +90,10 @@ type parseNode struct {
 	rule  *RuleTweet
 	left  *parseNode
 	right *parseNode
+
+	// Identifier and literal of a cond node, as they appeared in the input
+	ident   string
+	literal *token
 }
 
 func (node *parseNode) String() string {
@@ -75,13 +106,13 @@ type ParsedRule struct {
 	numNodes int
 }
 
-func evalInternal(tweet *Tweet, node *parseNode) bool {
+func evalInternal(ctx *EvalContext, tweet *Tweet, node *parseNode) bool {
 	switch node.kind {
 	case nodeCond:
-		return tweet.IsMatch(node.rule)
+		return tweet.isMatch(ctx, node.rule)
 	case nodeLogical:
-		left := evalInternal(tweet, node.left)
-		right := evalInternal(tweet, node.right)
+		left := evalInternal(ctx, tweet, node.left)
+		right := evalInternal(ctx, tweet, node.right)
 
 		switch node.op {
 		case tokenAnd:
@@ -91,15 +122,22 @@ func evalInternal(tweet *Tweet, node *parseNode) bool {
 		default:
 			panic(fmt.Sprintf("Unexpected logical op: %d\n", node.op))
 		}
+	case nodeNot:
+		return !evalInternal(ctx, tweet, node.left)
 	default:
 		panic(fmt.Sprintf("Unexpected node type: %d", node.kind))
 	}
 }
 
 // Eval walks the parse tree and evaluates each condition against
-// the given Tweet. Returns true if the Tweet matches all of the rules.
-func (rule *ParsedRule) Eval(tweet *Tweet) bool {
-	return evalInternal(tweet, rule.root)
+// the given Tweet in the given context. Returns true if the Tweet matches all
+// of the rules.
+//
+// Ages and dates are resolved against the context on every call, so a rule
+// that is evaluated periodically (e.g., in daemon mode) always uses fresh
+// ages.
+func (rule *ParsedRule) Eval(ctx *EvalContext, tweet *Tweet) bool {
+	return evalInternal(ctx.resolve(), tweet, rule.root)
 }
 
 // Parser is a simple parser for tweet deletion rule strings.
@@ -108,22 +146,36 @@ func (rule *ParsedRule) Eval(tweet *Tweet) bool {
 //
 // - age > 3d
 // - age > 10m3d || likes == 0
+// - age > 6h || age > 1w2d
 // - (likes > 10 && retweets > 3) || (text ~ "hello, world!")
-// - retweets >= 3 && time <= "10 May 2020"
+// - retweets >= 3 && created <= 10-May-2020
+// - created >= 2020-05-10 && created < 2020-05-10T14:00:00Z
+// - !(text ~ "pinned" || likes > 100)
+// - is_retweet == true && age > 30d
+// - replies == 0 && engagement < 5
+// - followers < 100 && likes == 0
+// - is_reply == true && is_thread == false
+// - created in [2019-01-01, 2019-06-30]
+// - hour in [0, 4] && weekday in [sat, sun]
+// - text contains "giveaway"i || text startswith "RT"
 //
 // Grammar:
 //
-// Expr    <-  ( Expr ) | Cond [Logical Expr]?
+// Expr    <-  Term [Or Term]*
+// Term    <-  Factor [And Factor]*
+// Factor  <-  Not Factor | ( Expr ) | Cond
 // Cond	   <-  Ident Op Literal
-// Logical <-  Or | And
-// Op      <-  Gt | Gte | Lt | Lte | Eq | Neq | In | NotIn
-// Literal <-  Number | String | Age | Time
+// Op      <-  Gt | Gte | Lt | Lte | Eq | Neq | In | NotIn | Contains | Word | StartsWith | EndsWith | InRange
+// Literal <-  Number | String | Age | Time | Bool | Weekday | Range
 //
 // Ident   :=  [A-Za-z0-9_]+
 // Number  :=  [0-9]+
-// String  :=  " [^"]* "
-// Age     :=  ^\s*([0-9]+[ymd])?([0-9]+[ymd])?([0-9]+[ymd])
-// Time    :=  \d\d-\w\w\w-\d\d\d\d
+// String  :=  " [^"]* " [a-zA-Z]*
+// Age     :=  ([0-9]+ (y | m | w | d | h | min | s))+
+// Time    :=  \d\d-\w\w\w-\d\d\d\d | \d\d\d\d-\d\d-\d\d [T\d\d:\d\d [:\d\d [.\d+]] [Z | [+-]\d\d:\d\d]]
+// Bool    :=  true | false
+// Weekday :=  mon | tue | wed | thu | fri | sat | sun
+// Range   :=  [ Literal , Literal ]
 // Lparen  :=  (
 // Rparen  :=  )
 // Or	   :=  ||
@@ -136,6 +188,37 @@ func (rule *ParsedRule) Eval(tweet *Tweet) bool {
 // Neq     :=  !=
 // In      :=  ~
 // NotIn   :=  !~
+// Not     :=  !
+// Contains    :=  contains
+// Word        :=  word
+// StartsWith  :=  startswith
+// EndsWith    :=  endswith
+// InRange     :=  in
+//
+// "!" binds tighter than "&&", which in turn binds tighter than "||".
+//
+// Strings are matched against the tweet text as a regexp with "~" and "!~",
+// or literally with "contains", "word" (whole words only), "startswith",
+// and "endswith". A string may be followed by regexp flags, e.g., "i" for
+// case-insensitive matching: text contains "hello"i
+//
+// Ages are made up of years (y), months (m), weeks (w), days (d), hours (h),
+// minutes (min), and seconds (s), in any order, e.g., 1y6m or 2h30min.
+//
+// Times are either dates (10-May-2020 or 2020-05-10) or ISO-8601 datetimes
+// (2020-05-10T14:00:00Z). A time covers the whole of its smallest unit: a
+// date is the entire day, and "created == 2020-05-10" matches any tweet
+// posted on that day. Dates and datetimes without a time zone are
+// interpreted in the location of the EvalContext the rule is evaluated in.
+//
+// Ranges are inclusive, and are compared with "in": "created in [2019-01-01,
+// 2019-06-30]" matches any tweet posted in the first half of 2019. "hour"
+// (0 to 23) and "weekday" are taken in the location of the EvalContext, and
+// their ranges may wrap around, e.g., "hour in [22, 2]".
+//
+// "followers" is the follower count of the account in the EvalContext, and
+// "is_thread" is true for replies to that account, i.e., tweets that continue
+// one of its threads.
 type Parser struct {
 	lexer *lexer
 
@@ -150,19 +233,53 @@ type Parser struct {
 type ParserError struct {
 	msg  string
 	pos  int
+	line int
+	col  int
 	kind tokenKind
 	val  string
-	// TODO: Add line
 }
 
 func (err *ParserError) Error() string {
-	return fmt.Sprintf("%s: \"%s\" (%s) (at col %d)", err.msg, err.val, err.kind.ToString(), err.pos+1)
+	return fmt.Sprintf("%s: \"%s\" (%s) (at line %d, col %d)",
+		err.msg, err.val, err.kind.ToString(), err.line, err.col)
+}
+
+// Message returns the error message, without the position
+func (err *ParserError) Message() string {
+	return err.msg
+}
+
+// Pos returns the byte offset of the offending token in the input
+func (err *ParserError) Pos() int {
+	return err.pos
+}
+
+// Line returns the line of the offending token (1-indexed)
+func (err *ParserError) Line() int {
+	return err.line
+}
+
+// Col returns the column of the offending token (1-indexed)
+func (err *ParserError) Col() int {
+	return err.col
+}
+
+// Token returns the value of the offending token
+func (err *ParserError) Token() string {
+	return err.val
+}
+
+// TokenKind returns a description of the kind of the offending token
+func (err *ParserError) TokenKind() string {
+	return err.kind.ToString()
 }
 
 func newParserError(msg string, token *token) *ParserError {
 	return &ParserError{
 		msg:  msg,
 		pos:  token.pos,
+		line: token.line,
+		col:  token.col,
 		kind: token.kind,
 		val:  token.val,
 	}
@@ -176,8 +293,8 @@ func (parser *Parser) match(kind tokenKind) (*token, error) {
 	// If the current token is not a match, return the token for
 	// error reporting purposes. Do not consume the token.
 	if currToken.kind != kind {
-		return currToken, fmt.Errorf(`Unexpected token - found: "%s", expected: "%s"`,
-			currToken.kind.ToString(), kind.ToString())
+		msg := fmt.Sprintf("Unexpected token, expected %s", kind.ToString())
+		return currToken, newParserError(msg, currToken)
 	}
 
 	token, err := parser.lexer.nextToken()
@@ -190,69 +307,124 @@ func (parser *Parser) match(kind tokenKind) (*token, error) {
 	return currToken, nil
 }
 
+// Parses a chain of "||" expressions. Since "&&" binds tighter than "||",
+// each operand is parsed as a term.
 func (parser *Parser) expr() (*parseNode, error) {
-	var node *parseNode
-	var err error
+	node, err := parser.term()
+	if err != nil {
+		return nil, err
+	}
 
-	for {
-		token := parser.currToken
+	for parser.currToken.kind == tokenOr {
+		op, err := parser.logical()
+		if err != nil {
+			return nil, err
+		}
 
-		// TODO(aksiksi): Handle the case of a non-logical expression that follows
-		// an expression or cond
-		switch token.kind {
-		// Nested expression
-		case tokenLparen:
-			_, err = parser.match(tokenLparen)
-			if err != nil {
-				return nil, err
-			}
+		right, err := parser.term()
+		if err != nil {
+			return nil, err
+		}
 
-			// Parse the internal expression and return the resulting node
-			node, err = parser.expr()
-			if err != nil {
-				return nil, err
-			}
+		node = &parseNode{
+			kind:  nodeLogical,
+			op:    op.kind,
+			left:  node,
+			right: right,
+		}
 
-			token, err = parser.match(tokenRparen)
-			if err != nil {
-				return nil, err
-			}
-		// Conditional expression
-		case tokenIdent:
-			node, err = parser.cond()
-			if err != nil {
-				return nil, err
-			}
-		// Logical/binary expression
-		case tokenAnd, tokenOr:
-			// Logical expresion with no preceding expression is invalid
-			if node == nil {
-				return nil, fmt.Errorf("Unexpected logical operator at %d: %s", token.pos, token.kind.ToString())
-			}
+		parser.rule.numNodes++
+	}
 
-			op, err := parser.logical()
-			if err != nil {
-				return nil, err
-			}
+	return node, nil
+}
 
-			newNode, err := parser.expr()
-			if err != nil {
-				return nil, err
-			}
+// Parses a chain of "&&" expressions
+func (parser *Parser) term() (*parseNode, error) {
+	node, err := parser.factor()
+	if err != nil {
+		return nil, err
+	}
 
-			node = &parseNode{
-				kind:  nodeLogical,
-				op:    op.kind,
-				rule:  nil,
-				left:  node,
-				right: newNode,
-			}
-		default:
-			return node, nil
+	for parser.currToken.kind == tokenAnd {
+		op, err := parser.logical()
+		if err != nil {
+			return nil, err
+		}
+
+		right, err := parser.factor()
+		if err != nil {
+			return nil, err
+		}
+
+		node = &parseNode{
+			kind:  nodeLogical,
+			op:    op.kind,
+			left:  node,
+			right: right,
 		}
 
 		parser.rule.numNodes++
 	}
+
+	return node, nil
+}
+
+// Parses a negation, a nested expression, or a single condition
+func (parser *Parser) factor() (*parseNode, error) {
+	var node *parseNode
+	var err error
+
+	token := parser.currToken
+
+	switch token.kind {
+	// Negated expression
+	case tokenNot:
+		_, err = parser.match(tokenNot)
+		if err != nil {
+			return nil, err
+		}
+
+		child, err := parser.factor()
+		if err != nil {
+			return nil, err
+		}
+
+		node = &parseNode{
+			kind: nodeNot,
+			op:   tokenNot,
+			left: child,
+		}
+	// Nested expression
+	case tokenLparen:
+		_, err = parser.match(tokenLparen)
+		if err != nil {
+			return nil, err
+		}
+
+		// Parse the internal expression and return the resulting node
+		node, err = parser.expr()
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = parser.match(tokenRparen)
+		if err != nil {
+			return nil, err
+		}
+	// Conditional expression
+	case tokenIdent:
+		node, err = parser.cond()
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, newParserError("Unexpected token at start of expression", token)
+	}
+
+	parser.rule.numNodes++
+
+	return node, nil
 }
 
 func (parser *Parser) cond() (*parseNode, error) {
@@ -271,6 +443,11 @@ func (parser *Parser) cond() (*parseNode, error) {
 		return nil, err2
 	}
 
+	return buildCond(ident, op, literal)
+}
+
+// Builds a condition node from its identifier, operator, and literal tokens
+func buildCond(ident, op, literal *token) (*parseNode, error) {
 	// Build the rule
 	rule := &RuleTweet{}
 
@@ -280,16 +457,15 @@ func (parser *Parser) cond() (*parseNode, error) {
 			return nil, newParserError("Invalid literal for \"age\"", literal)
 		}
 
-		time, err3 := convertAgeToTime(literal.val)
+		units, err3 := parseAge(literal.val)
 		if err3 != nil {
 			return nil, newParserError("Invalid format for \"age\"", literal)
 		}
 
 		switch op.kind {
-		case tokenGt, tokenGte:
-			rule.Before = time
-		case tokenLt, tokenLte:
-			rule.After = time
+		case tokenGt, tokenGte, tokenLt, tokenLte:
+			rule.Age = units.resolve()
+			rule.AgeComparator = countComparator(op.kind)
 		default:
 			return nil, newParserError("Invalid operator for \"age\"", op)
 		}
@@ -298,103 +474,337 @@ func (parser *Parser) cond() (*parseNode, error) {
 			return nil, newParserError("Invalid literal for \"text\"", literal)
 		}
 
+		s, flags := splitStringLiteral(literal.val)
+
+		for _, flag := range flags {
+			if !strings.ContainsRune(regexpFlags, flag) {
+				return nil, newParserError(fmt.Sprintf("Invalid regexp flag \"%c\"", flag), literal)
+			}
+		}
+
+		var pat string
+
+		// Literal operators match the text as is, so "\\" stands for a
+		// single backslash. Regexps handle their own escapes.
+		if op.kind != tokenIn && op.kind != tokenNotIn {
+			s = unescapeBackslashes(s)
+		}
+
 		switch op.kind {
 		case tokenIn, tokenNotIn:
-			// Gotcha: the literal contains quotes - remove them before building the regexp
-			pat := strings.Replace(literal.val, "\"", "", 2)
-
-			rule.Match = regexp.MustCompile(pat)
-			rule.IsNegativeMatch = (op.kind == tokenNotIn)
+			pat = s
+		case tokenContains:
+			pat = regexp.QuoteMeta(s)
+		case tokenWord:
+			// Unlike \b, this also works for words that start or end with a
+			// non-word character, such as "@user" or "c++", and for words
+			// with non-ASCII letters, such as "café"
+			pat = `(^|` + nonWordChar + `)` + regexp.QuoteMeta(s) + `(` + nonWordChar + `|$)`
+		case tokenStartsWith:
+			pat = "^" + regexp.QuoteMeta(s)
+		case tokenEndsWith:
+			pat = regexp.QuoteMeta(s) + "$"
 		default:
 			return nil, newParserError("Invalid operator for \"text\"", op)
 		}
+
+		if flags != "" {
+			pat = "(?" + flags + ")" + pat
+		}
+
+		match, err := regexp.Compile(pat)
+		if err != nil {
+			return nil, newParserError(fmt.Sprintf("Invalid regexp: %s", err), literal)
+		}
+
+		rule.Match = match
+		rule.IsNegativeMatch = (op.kind == tokenNotIn)
 	case "created":
-		if literal.kind != tokenTime {
-			return nil, newParserError("Invalid literal for \"created\"", literal)
+		from, to, err := condBounds(op, literal)
+		if err != nil {
+			return nil, err
 		}
 
-		time, err4 := time.Parse(timeLayout, literal.val)
-		if err4 != nil {
-			return nil, newParserError("Invalid time format for \"created\"", literal)
+		var starts [2]time.Time
+		var ends [2]time.Time
+
+		for i, bound := range []*token{from, to} {
+			if bound.kind != tokenTime {
+				return nil, newParserError("Invalid literal for \"created\"", bound)
+			}
+
+			// The time may depend on the location, which is only known when
+			// the rule is evaluated
+			starts[i], ends[i], err = parseTimeRange(bound.val, time.UTC)
+			if err != nil {
+				return nil, newParserError("Invalid time format for \"created\"", bound)
+			}
 		}
 
-		switch op.kind {
-		case tokenGt, tokenGte:
-			rule.Before = time
-		case tokenLt, tokenLte:
-			rule.After = time
-		default:
+		if !starts[0].Before(ends[1]) {
+			return nil, newParserError("Empty range for \"created\"", literal)
+		}
+
+		// A range covers all times from the start of its first bound to the
+		// end of its last bound
+		comparator := comparatorEq
+		if op.kind != tokenInRange {
+			comparator = countComparator(op.kind)
+		}
+
+		if comparator == comparatorNone {
 			return nil, newParserError("Invalid operator for \"created\"", op)
 		}
-	case "likes":
-		if literal.kind != tokenNumber {
-			return nil, newParserError("Invalid literal for \"likes\"", literal)
+
+		rule.Created = from.val
+		rule.CreatedUntil = to.val
+		rule.CreatedComparator = comparator
+	case "hour":
+		from, to, err := condBounds(op, literal)
+		if err != nil {
+			return nil, err
 		}
 
-		num, err := strconv.Atoi(literal.val)
+		var hours [2]int
+
+		for i, bound := range []*token{from, to} {
+			if bound.kind != tokenNumber {
+				return nil, newParserError("Invalid literal for \"hour\"", bound)
+			}
+
+			hours[i], err = strconv.Atoi(bound.val)
+			if err != nil || hours[i] > 23 {
+				return nil, newParserError("Invalid hour, must be between 0 and 23", bound)
+			}
+		}
+
+		comparator := comparatorIn
+		if op.kind != tokenInRange {
+			comparator = countComparator(op.kind)
+		}
+
+		if comparator == comparatorNone {
+			return nil, newParserError("Invalid operator for \"hour\"", op)
+		}
+
+		rule.Hour = hours[0]
+		rule.HourUntil = hours[1]
+		rule.HourComparator = comparator
+	case "weekday":
+		from, to, err := condBounds(op, literal)
 		if err != nil {
-			return nil, newParserError("Invalid number for \"likes\"", literal)
+			return nil, err
 		}
 
-		rule.Likes = num
+		for _, bound := range []*token{from, to} {
+			if bound.kind != tokenWeekday {
+				return nil, newParserError("Invalid literal for \"weekday\"", bound)
+			}
+		}
 
+		// Weeks start on different days in different places, so weekdays
+		// are not ordered
 		switch op.kind {
-		case tokenGt:
-			rule.LikesComparator = comparatorGt
-		case tokenGte:
-			rule.LikesComparator = comparatorGte
-		case tokenLt:
-			rule.LikesComparator = comparatorLt
-		case tokenLte:
-			rule.LikesComparator = comparatorLte
 		case tokenEq:
-			rule.LikesComparator = comparatorEq
+			rule.WeekdayComparator = comparatorEq
 		case tokenNeq:
-			rule.LikesComparator = comparatorNeq
+			rule.WeekdayComparator = comparatorNeq
+		case tokenInRange:
+			rule.WeekdayComparator = comparatorIn
 		default:
-			return nil, newParserError("Invalid operator for \"likes\"", op)
+			return nil, newParserError("Invalid operator for \"weekday\"", op)
 		}
-	case "retweets":
+
+		rule.Weekday = weekdayNames[from.val]
+		rule.WeekdayUntil = weekdayNames[to.val]
+	case "likes", "retweets", "replies", "quotes", "engagement", "followers":
 		if literal.kind != tokenNumber {
-			return nil, newParserError("Invalid literal for \"retweets\"", literal)
+			return nil, newParserError(fmt.Sprintf("Invalid literal for \"%s\"", ident.val), literal)
 		}
 
 		num, err := strconv.Atoi(literal.val)
 		if err != nil {
-			return nil, newParserError("Invalid number for \"retweets\"", literal)
+			return nil, newParserError(fmt.Sprintf("Invalid number for \"%s\"", ident.val), literal)
+		}
+
+		comparator := countComparator(op.kind)
+		if comparator == comparatorNone {
+			return nil, newParserError(fmt.Sprintf("Invalid operator for \"%s\"", ident.val), op)
+		}
+
+		switch ident.val {
+		case "likes":
+			rule.Likes = num
+			rule.LikesComparator = comparator
+		case "retweets":
+			rule.Retweets = num
+			rule.RetweetsComparator = comparator
+		case "replies":
+			rule.Replies = num
+			rule.RepliesComparator = comparator
+		case "quotes":
+			rule.Quotes = num
+			rule.QuotesComparator = comparator
+		case "engagement":
+			rule.Engagement = num
+			rule.EngagementComparator = comparator
+		case "followers":
+			rule.Followers = num
+			rule.FollowersComparator = comparator
+		}
+	case "is_retweet", "is_reply", "is_quote", "has_media", "has_link", "is_thread":
+		if literal.kind != tokenBool {
+			return nil, newParserError(fmt.Sprintf("Invalid literal for \"%s\"", ident.val), literal)
 		}
 
-		rule.Retweets = num
+		val := literal.val == "true"
 
 		switch op.kind {
-		case tokenGt:
-			rule.RetweetsComparator = comparatorGt
-		case tokenGte:
-			rule.RetweetsComparator = comparatorGte
-		case tokenLt:
-			rule.RetweetsComparator = comparatorLt
-		case tokenLte:
-			rule.RetweetsComparator = comparatorLte
 		case tokenEq:
-			rule.RetweetsComparator = comparatorEq
+			rule.AttributeValue = val
 		case tokenNeq:
-			rule.RetweetsComparator = comparatorNeq
+			rule.AttributeValue = !val
 		default:
-			return nil, newParserError("Invalid operator for \"retweets\"", op)
+			return nil, newParserError(fmt.Sprintf("Invalid operator for \"%s\"", ident.val), op)
 		}
+
+		rule.Attribute = attributeIdents[ident.val]
 	default:
 		return nil, newParserError("Invalid identifier", ident)
 	}
 
 	node := &parseNode{
-		kind: nodeCond,
-		rule: rule,
-		op:   op.kind,
+		kind:    nodeCond,
+		rule:    rule,
+		op:      op.kind,
+		ident:   ident.val,
+		literal: literal,
 	}
 
 	return node, nil
 }
 
+// Returns the bounds that a condition compares against: the two bounds of
+// the range for "in", or the literal itself for any other operator
+func condBounds(op, literal *token) (*token, *token, error) {
+	if op.kind != tokenInRange {
+		return literal, literal, nil
+	}
+
+	if literal.kind != tokenRange {
+		return nil, nil, newParserError("Expected a range, e.g., [1, 5]", literal)
+	}
+
+	return splitRange(literal)
+}
+
+// Splits a range literal token into the literal tokens of its two bounds
+func splitRange(literal *token) (*token, *token, error) {
+	parts := strings.Split(literal.val[1:len(literal.val)-1], ",")
+	if len(parts) != 2 {
+		return nil, nil, newParserError("A range must have exactly two bounds", literal)
+	}
+
+	var bounds [2]*token
+
+	// Offset of the current part from the start of the range
+	offset := 1
+
+	for i, part := range parts {
+		lexer := newLexer(Tokens, part)
+
+		bound, err := lexer.nextToken()
+		if err != nil || bound.kind == tokenRange {
+			return nil, nil, newParserError("Invalid bound in range", literal)
+		}
+
+		if _, ok := literalTypes[bound.kind]; !ok {
+			return nil, nil, newParserError("Invalid bound in range", literal)
+		}
+
+		if next, err := lexer.nextToken(); err != nil || next.kind != tokenEOF {
+			return nil, nil, newParserError("Invalid bound in range", literal)
+		}
+
+		// Convert the position of the bound to a position in the input
+		pos := offset + bound.pos
+		bound.pos = literal.pos + pos
+		bound.line = literal.line
+		bound.col = literal.col + pos
+
+		bounds[i] = bound
+		offset += len(part) + 1
+	}
+
+	return bounds[0], bounds[1], nil
+}
+
+// Splits a string literal token into its contents (without quotes) and the
+// regexp flags that follow it. Escaped quotes in the contents are unescaped;
+// any other backslash is kept as is, so that regexp escapes like "\d" work.
+func splitStringLiteral(val string) (string, string) {
+	end := strings.LastIndex(val, "\"")
+
+	var contents strings.Builder
+
+	for i := 1; i < end; i++ {
+		if val[i] == '\\' && i+1 < end {
+			if val[i+1] != '"' {
+				contents.WriteByte('\\')
+			}
+
+			i++
+		}
+
+		contents.WriteByte(val[i])
+	}
+
+	return contents.String(), val[end+1:]
+}
+
+// Replaces each escaped backslash ("\\") in the given string literal contents
+// with a single backslash. All other backslashes are kept.
+func unescapeBackslashes(s string) string {
+	var unescaped strings.Builder
+
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) && s[i+1] == '\\' {
+			i++
+		}
+
+		unescaped.WriteByte(s[i])
+	}
+
+	return unescaped.String()
+}
+
+// Quotes the given string as the contents of a string literal
+func quoteString(s string) string {
+	return "\"" + strings.ReplaceAll(s, "\"", "\\\"") + "\""
+}
+
+// Converts a comparison operator to the comparator used by count-based
+// conditions. Returns comparatorNone if the operator cannot be used to
+// compare counts.
+func countComparator(op tokenKind) ruleComparator {
+	switch op {
+	case tokenGt:
+		return comparatorGt
+	case tokenGte:
+		return comparatorGte
+	case tokenLt:
+		return comparatorLt
+	case tokenLte:
+		return comparatorLte
+	case tokenEq:
+		return comparatorEq
+	case tokenNeq:
+		return comparatorNeq
+	default:
+		return comparatorNone
+	}
+}
+
 func (parser *Parser) ident() (*token, error) {
 	token, err := parser.match(tokenIdent)
 	if err != nil {
@@ -424,7 +834,8 @@ func (parser *Parser) op() (*token, error) {
 	token := parser.currToken
 
 	switch token.kind {
-	case tokenLt, tokenLte, tokenGt, tokenGte, tokenEq, tokenNeq, tokenIn, tokenNotIn:
+	case tokenLt, tokenLte, tokenGt, tokenGte, tokenEq, tokenNeq, tokenIn, tokenNotIn,
+		tokenContains, tokenWord, tokenStartsWith, tokenEndsWith, tokenInRange:
 		token, err := parser.match(parser.currToken.kind)
 		if err != nil {
 			return nil, err
@@ -440,7 +851,7 @@ func (parser *Parser) literal() (*token, error) {
 	token := parser.currToken
 
 	switch token.kind {
-	case tokenString, tokenNumber, tokenAge, tokenTime:
+	case tokenString, tokenNumber, tokenAge, tokenTime, tokenBool, tokenWeekday, tokenRange:
 		token, err := parser.match(token.kind)
 		if err != nil {
 			return nil, err
@@ -505,11 +916,19 @@ func (parser *Parser) Parse() (*ParsedRule, error) {
 	parser.currToken = token
 
 	node, err := parser.expr()
+	if err != nil {
+		return nil, err
+	}
+
+	// The expression must consume the entire input
+	if parser.currToken.kind != tokenEOF {
+		return nil, newParserError("Unexpected token after expression", parser.currToken)
+	}
 
 	// Set the root to the returned root
 	parser.rule.root = node
 
-	return parser.rule, err
+	return parser.rule, nil
 }
 
 // Parse is the entry point to the rule parser infra.
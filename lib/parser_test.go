@@ -1,6 +1,7 @@
 package histweet
 
 import (
+	"errors"
 	"testing"
 	"time"
 )
@@ -26,6 +27,23 @@ func TestParser(t *testing.T) {
 		{`((text !~ "hey!") && (likes == 5) && (likes == 3)) || ( likes == 9)`, 12},
 		{`((text !~ "hey!") && (likes == 5)) || created < 10-May-2020 || likes == 9`, 10},
 		{`((text !~ "hey!") && (likes == 5)) || created > 10-May-2020 || likes == 9`, 10},
+		{`!(text ~ "pinned" || likes > 100)`, 5},
+		{`!text ~ "pinned" && !!(likes > 100)`, 7},
+		{"likes > 3 || likes < 2 && retweets == 1", 5},
+
+		{"replies == 0 && quotes < 3 || engagement >= 10", 5},
+		{"replies != 1 && quotes > 0 && engagement <= 3", 5},
+		{"is_retweet == true && age > 30d", 3},
+		{"is_reply != false || has_media == true", 3},
+		{"!(is_quote == true) && has_link == false", 5},
+
+		// Invalid negations
+		{"!", -1},
+		{"likes > 3 !", -1},
+		{"likes > 3 && !", -1},
+
+		// Missing logical operator
+		{"likes > 3 retweets > 2", -1},
 
 		// Invalid literals (from left to right)
 		{`created > "xyz"`, -1},
@@ -36,6 +54,12 @@ func TestParser(t *testing.T) {
 		{`((text !~ "hey!") && (likes == x)) || created < 10-May-2020 || likes == 9`, -1},
 		{`((text !~ "hey!") && (likes == 5)) || created < 10-Potato-2020 || likes == 9`, -1},
 
+		{"is_retweet == 1", -1},
+		{`has_link == "true"`, -1},
+		{"likes > true", -1},
+		{"replies > 3d", -1},
+		{`engagement == "abc"`, -1},
+
 		// Invalid identifiers
 		{`hummus !~ "hey!" && likes == 5`, -1},
 		{`text !~ "hey!" || hates == 5`, -1},
@@ -48,6 +72,9 @@ func TestParser(t *testing.T) {
 		{"retweets !~ 10", -1},
 		{`text < "abcd"`, -1},
 		{`created ~ 10-May-2020`, -1},
+		{"is_reply > false", -1},
+		{"quotes ~ 3", -1},
+		{"has_media ~ true", -1},
 
 		// Unbalanced parens
 		{"(age > 3m && likes >= 34 || text !~ \"xyz\"", -1},
@@ -84,11 +111,48 @@ func TestParser(t *testing.T) {
 				NumLikes: 10,
 			}
 
-			rule.Eval(&tweet)
+			rule.Eval(nil, &tweet)
 		})
 	}
 }
 
+func TestParserErrorPosition(t *testing.T) {
+	_, err := NewParser("likes > 3 &&\n  retweets >= text").Parse()
+
+	var parserErr *ParserError
+	if !errors.As(err, &parserErr) {
+		t.Fatalf("Expected a ParserError, got: %v", err)
+	}
+
+	if parserErr.Line() != 2 || parserErr.Col() != 15 || parserErr.Pos() != 27 {
+		t.Errorf("Error at line %d, col %d, pos %d, expected line 2, col 15, pos 27",
+			parserErr.Line(), parserErr.Col(), parserErr.Pos())
+	}
+
+	if parserErr.Token() != "text" || parserErr.TokenKind() != tokenIdent.ToString() || parserErr.Message() == "" {
+		t.Errorf("Unexpected error details: %s", err)
+	}
+}
+
+func TestParserInvalidRegexp(t *testing.T) {
+	_, err := NewParser("likes > 3 &&\n  text ~ \"(\"").Parse()
+
+	var parserErr *ParserError
+	if !errors.As(err, &parserErr) {
+		t.Fatalf("Expected a ParserError, got: %v", err)
+	}
+
+	if parserErr.Line() != 2 || parserErr.Col() != 10 || parserErr.Token() != `"("` {
+		t.Errorf("Error at line %d, col %d, token %s, expected line 2, col 10, token \"(\"",
+			parserErr.Line(), parserErr.Col(), parserErr.Token())
+	}
+
+	// Parens inside strings are not counted as unbalanced
+	if _, err := Parse(`text ~ "\("`); err != nil {
+		t.Errorf("Failed to parse rule with a paren in a string: %s", err)
+	}
+}
+
 func TestParserEval(t *testing.T) {
 	// Checks that parser evaluates rules correctly
 	var inputs = []struct {
@@ -118,11 +182,17 @@ func TestParserEval(t *testing.T) {
 		{`((text !~ "abc") && (likes == 5)) || created < 10-May-2020 || likes == 9`, Tweet{
 			Text:      "abc",
 			NumLikes:  6,
-			CreatedAt: time.Date(2020, 5, 11, 0, 0, 0, 0, time.UTC),
+			CreatedAt: time.Date(2020, 5, 9, 0, 0, 0, 0, time.UTC),
 		}},
 		{`((text !~ "abc") && (likes == 5)) || created < 10-May-2020 || likes == 9`, Tweet{
 			NumLikes: 9,
 		}},
+		{`text ~ "^hello"i`, Tweet{Text: "HELLO, world"}},
+		{`text contains "a.b (c)"`, Tweet{Text: "see a.b (c)!"}},
+		{`text contains "GIVEAWAY"i && text !~ "giveaway"`, Tweet{Text: "Giveaway!"}},
+		{`text word "cat" && !(text word "dog")`, Tweet{Text: "my cat, dogs"}},
+		{`text startswith "RT @" && text endswith "..."`, Tweet{Text: "RT @user: hi..."}},
+		{`text contains "say \"hi\"" && text ~ "\d+ (times|days)"`, Tweet{Text: `say "hi" 3 times`}},
 	}
 
 	for _, input := range inputs {
@@ -132,7 +202,7 @@ func TestParserEval(t *testing.T) {
 				t.Errorf("Failed to parse rule: %s", err)
 			}
 
-			isMatch := rule.Eval(&input.tweet)
+			isMatch := rule.Eval(nil, &input.tweet)
 			if !isMatch {
 				t.Errorf("Failed to evaluate rule: %s, %v", input.rule, input.tweet)
 			}
@@ -140,6 +210,324 @@ func TestParserEval(t *testing.T) {
 	}
 }
 
+func TestParserCreated(t *testing.T) {
+	tokyo := time.FixedZone("JST", 9*60*60)
+
+	var inputs = []struct {
+		rule     string
+		created  time.Time
+		expected bool
+	}{
+		{"created == 2020-05-10", time.Date(2020, 5, 10, 23, 59, 59, 0, time.UTC), true},
+		{"created == 10-May-2020", time.Date(2020, 5, 11, 0, 0, 0, 0, time.UTC), false},
+		{"created != 2020-05-10", time.Date(2020, 5, 9, 12, 0, 0, 0, time.UTC), true},
+		{"created > 2020-05-10", time.Date(2020, 5, 10, 12, 0, 0, 0, time.UTC), false},
+		{"created > 2020-05-10", time.Date(2020, 5, 11, 0, 0, 0, 0, time.UTC), true},
+		{"created >= 2020-05-10", time.Date(2020, 5, 10, 0, 0, 0, 0, time.UTC), true},
+		{"created < 2020-05-10", time.Date(2020, 5, 10, 0, 0, 0, 0, time.UTC), false},
+		{"created <= 2020-05-10", time.Date(2020, 5, 10, 23, 0, 0, 0, time.UTC), true},
+		{"created < 2020-05-10T14:00:00Z", time.Date(2020, 5, 10, 13, 59, 59, 0, time.UTC), true},
+		{"created < 2020-05-10T14:00:00+02:00", time.Date(2020, 5, 10, 12, 30, 0, 0, time.UTC), false},
+		{"created == 2020-05-10T14:00Z", time.Date(2020, 5, 10, 14, 0, 30, 0, time.UTC), true},
+		{"created > 2020-05-10T14:00:00.5Z", time.Date(2020, 5, 10, 14, 0, 0, 600, time.UTC), false},
+		{"created == 2020-05-10", time.Date(2020, 5, 10, 0, 0, 0, 0, tokyo), false},
+	}
+
+	for _, input := range inputs {
+		t.Run(input.rule, func(t *testing.T) {
+			rule, err := Parse(input.rule)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if rule.Eval(nil, &Tweet{CreatedAt: input.created}) != input.expected {
+				t.Errorf("Expected %v for tweet created at %s", input.expected, input.created)
+			}
+		})
+	}
+
+	// Times without a time zone are interpreted in the context's location
+	rule, err := Parse("created == 2020-05-10")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := &EvalContext{Location: tokyo}
+	if !rule.Eval(ctx, &Tweet{CreatedAt: time.Date(2020, 5, 9, 15, 0, 0, 0, time.UTC)}) {
+		t.Errorf("Expected the date to be interpreted in the context's location")
+	}
+
+	invalid := []string{
+		"created > 2020-13-01",
+		"created > 2020-05-10T25:00",
+		"created ~ 2020-05-10",
+	}
+
+	for _, input := range invalid {
+		if _, err := Parse(input); err == nil {
+			t.Errorf("Expected an error for rule: %s", input)
+		}
+	}
+}
+
+func TestParserAge(t *testing.T) {
+	now := time.Date(2020, 5, 10, 12, 0, 0, 0, time.UTC)
+
+	var inputs = []struct {
+		age      string
+		expected time.Time
+	}{
+		{"3d", time.Date(2020, 5, 7, 12, 0, 0, 0, time.UTC)},
+		{"1y2m", time.Date(2019, 3, 10, 12, 0, 0, 0, time.UTC)},
+		{"2m1y", time.Date(2019, 3, 10, 12, 0, 0, 0, time.UTC)},
+		{"1w2d", time.Date(2020, 5, 1, 12, 0, 0, 0, time.UTC)},
+		{"6h", time.Date(2020, 5, 10, 6, 0, 0, 0, time.UTC)},
+		{"30min", time.Date(2020, 5, 10, 11, 30, 0, 0, time.UTC)},
+		{"1h30min15s", time.Date(2020, 5, 10, 10, 29, 45, 0, time.UTC)},
+		{"1m1min", time.Date(2020, 4, 10, 11, 59, 0, 0, time.UTC)},
+	}
+
+	for _, input := range inputs {
+		units, err := parseAge(input.age)
+		if err != nil {
+			t.Errorf("Failed to parse age %s: %s", input.age, err)
+			continue
+		}
+
+		if before := units.resolve().Before(now); !before.Equal(input.expected) {
+			t.Errorf("Age %s before %s = %s, expected %s", input.age, now, before, input.expected)
+		}
+	}
+
+	for _, input := range []string{"", "3", "3x", "1d2d", "3mins", "d"} {
+		if _, err := parseAge(input); err == nil {
+			t.Errorf("Expected an error for age: %q", input)
+		}
+	}
+
+	rule, err := Parse("age > 6h && age < 1d")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := &EvalContext{Now: now}
+
+	if !rule.Eval(ctx, &Tweet{CreatedAt: now.Add(-7 * time.Hour)}) {
+		t.Errorf("Expected a tweet from 7 hours ago to match")
+	}
+
+	tweet := &Tweet{CreatedAt: now.Add(-5 * time.Hour)}
+	if rule.Eval(ctx, tweet) {
+		t.Errorf("Expected a tweet from 5 hours ago not to match")
+	}
+
+	// Ages are resolved when the rule is evaluated, not when it is parsed
+	ctx.Now = now.Add(2 * time.Hour)
+
+	if !rule.Eval(ctx, tweet) || !rule.Explain(ctx, tweet).Result {
+		t.Errorf("Expected the tweet to match two hours later")
+	}
+
+	if _, err := Parse("age > 1d2d"); err == nil {
+		t.Errorf("Expected an error for an age with a repeated unit")
+	}
+}
+
+func TestParserTimeWindows(t *testing.T) {
+	// Saturday, July 4th 2020 at 02:30 UTC
+	created := time.Date(2020, 7, 4, 2, 30, 0, 0, time.UTC)
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var inputs = []struct {
+		rule     string
+		location *time.Location
+		expected bool
+	}{
+		{"created in [2020-07-01, 2020-07-04]", nil, true},
+		{"created in [2020-07-04T02:00Z, 2020-07-04T02:30Z]", nil, true},
+		{"created in [2020-06-01, 2020-07-03]", nil, false},
+		{"created in [2020-07-04, 2020-07-31]", newYork, false},
+		{"hour in [0, 4]", nil, true},
+		{"hour in [22, 2]", nil, true},
+		{"hour in [22, 2]", newYork, true},
+		{"hour in [3, 21]", nil, false},
+		{"hour < 3 && hour >= 2", nil, true},
+		{"hour == 22", newYork, true},
+		{"weekday == sat", nil, true},
+		{"weekday == sat", newYork, false},
+		{"weekday in [sat, sun]", nil, true},
+		{"weekday in [fri, mon]", newYork, true},
+		{"weekday in [mon, fri]", nil, false},
+		{"weekday != sat", nil, false},
+		{"hour in [0, 4] && weekday in [sat, sun]", nil, true},
+	}
+
+	for _, input := range inputs {
+		t.Run(input.rule, func(t *testing.T) {
+			rule, err := Parse(input.rule)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ctx := &EvalContext{Location: input.location}
+			if rule.Eval(ctx, &Tweet{CreatedAt: created}) != input.expected {
+				t.Errorf("Expected %v in location %v", input.expected, input.location)
+			}
+		})
+	}
+
+	invalid := []string{
+		"created in 2019-01-01",
+		"created in [2019-01-01]",
+		"created in [2019-01-01, 2019-02-01, 2019-03-01]",
+		"created in [2019-06-30, 2019-01-01]",
+		"created in [2019-01-01, 1d]",
+		"created > [2019-01-01, 2019-06-30]",
+		"hour in [0, 24]",
+		"hour > mon",
+		"hour ~ 3",
+		"weekday < sat",
+		"weekday in [1, 2]",
+		"likes in [1, 2]",
+		"age in [1d, 2d]",
+		"created in [2019-01-01, [2019-06-30]]",
+	}
+
+	for _, input := range invalid {
+		if _, err := Parse(input); err == nil {
+			t.Errorf("Expected an error for rule: %s", input)
+		}
+	}
+
+	// Errors in a range point to the offending bound
+	_, err = Parse("hour in [0,  24]")
+
+	var parserErr *ParserError
+	if !errors.As(err, &parserErr) {
+		t.Fatalf("Expected a ParserError, got: %v", err)
+	}
+
+	if parserErr.Token() != "24" || parserErr.Col() != 14 || parserErr.Pos() != 13 {
+		t.Errorf("Unexpected error position: %s (pos %d)", err, parserErr.Pos())
+	}
+}
+
+func TestParserTextOperators(t *testing.T) {
+	var inputs = []struct {
+		rule     string
+		text     string
+		expected bool
+	}{
+		{`text contains "a.b"`, "axb", false},
+		{`text ~ "hello"`, "HELLO", false},
+		{`text word "cat"`, "concatenate", false},
+		{`text word "cat"`, "my cat.", true},
+		{`text word "@bob"`, "hi @bob", true},
+		{`text word "@bob"`, "@bob: hi", true},
+		{`text word "@bob"`, "hi @bobby", false},
+		{`text word "@bob"`, "me@bob.com", false},
+		{`text word "c++"`, "I like c++ a lot", true},
+		{`text word "c++"`, "c++", true},
+		{`text word "c++"`, "c++x", false},
+		{`text word "#hashtag"`, "so #hashtag!", true},
+		{`text word "#hashtag"`, "#hashtags", false},
+		{`text word "#Hashtag"i`, "#HASHTAG", true},
+		{`text word "caf"`, "café au lait", false},
+		{`text word "café"`, "un café, merci", true},
+		{`text word "cafe"`, "cafe\u0301", false},
+		{`text word "über"i`, "Überall", false},
+		{`text word "東京"`, "東京タワー", false},
+		{`text word "東京"`, "in 東京 today", true},
+		{`text word "naïve"i`, "So NAÏVE!", true},
+		{`text contains "C:\\temp"`, `C:\temp`, true},
+		{`text contains "C:\\temp"`, `C:\\temp`, false},
+		{`text contains "C:\\\\temp"`, `C:\temp`, false},
+		{`text endswith "\\"`, `a\`, true},
+		{`text endswith "\\\""`, `say \"`, true},
+		{`text startswith "\d"`, `\d+`, true},
+		{`text ~ "C:\\temp"`, `C:\temp`, true},
+		{`text startswith "RT"`, "Not RT", false},
+		{`text endswith "."`, "end.!", false},
+		{`text startswith "rt"`, "RT @user", false},
+	}
+
+	for _, input := range inputs {
+		t.Run(input.rule+" "+input.text, func(t *testing.T) {
+			rule, err := Parse(input.rule)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if rule.Eval(nil, &Tweet{Text: input.text}) != input.expected {
+				t.Errorf("Expected %v for text: %s", input.expected, input.text)
+			}
+		})
+	}
+
+	invalid := []string{
+		`text contains "abc"x`,
+		`likes contains "3"`,
+		`text contains 3`,
+		`text word`,
+	}
+
+	for _, input := range invalid {
+		_, err := Parse(input)
+		if err == nil {
+			t.Errorf("Expected an error for rule: %s", input)
+		}
+	}
+}
+
+func TestParserPrecedence(t *testing.T) {
+	// Checks that "!" binds tighter than "&&", which binds tighter than "||"
+	var inputs = []struct {
+		rule     string
+		tweet    Tweet
+		expected bool
+	}{
+		{"likes > 3 || likes < 2 && retweets == 1", Tweet{NumLikes: 5, NumRetweets: 5}, true},
+		{"likes > 3 && retweets == 1 || likes < 2", Tweet{NumLikes: 1, NumRetweets: 5}, true},
+		{"likes > 3 && (retweets == 1 || likes < 2)", Tweet{NumLikes: 1, NumRetweets: 5}, false},
+		{"likes < 2 && retweets == 1 || likes > 3 && retweets > 3", Tweet{NumLikes: 5, NumRetweets: 1}, false},
+		{`!(text ~ "pinned" || likes > 100)`, Tweet{Text: "a pinned tweet"}, false},
+		{`!(text ~ "pinned" || likes > 100)`, Tweet{Text: "abc", NumLikes: 10}, true},
+		{`!text ~ "pinned" && likes > 3`, Tweet{Text: "abc", NumLikes: 10}, true},
+		{`!(likes > 3) || retweets > 3`, Tweet{NumLikes: 10, NumRetweets: 1}, false},
+		{`!!(likes > 3)`, Tweet{NumLikes: 10}, true},
+		{"is_retweet == true && likes < 3", Tweet{IsRetweet: true}, true},
+		{"is_retweet == true && likes < 3", Tweet{IsReply: true}, false},
+		{"is_reply != true", Tweet{IsReply: true}, false},
+		{"is_quote == false || has_media == true", Tweet{IsQuote: true, HasMedia: true}, true},
+		{"has_link == false", Tweet{HasLink: true}, false},
+		{"likes == 0", Tweet{NumLikes: 0}, true},
+		{"likes == 0", Tweet{NumLikes: 1}, false},
+		{"replies == 0", Tweet{NumLikes: 100}, true},
+		{"replies == 0", Tweet{NumReplies: 2}, false},
+		{"replies > 1 && quotes >= 2", Tweet{NumReplies: 2, NumQuotes: 2}, true},
+		{"quotes != 0", Tweet{NumQuotes: 0}, false},
+		{"engagement < 5", Tweet{NumLikes: 2, NumRetweets: 1, NumReplies: 1}, true},
+		{"engagement < 5", Tweet{NumLikes: 2, NumRetweets: 1, NumReplies: 2}, false},
+	}
+
+	for _, input := range inputs {
+		t.Run(input.rule, func(t *testing.T) {
+			rule, err := Parse(input.rule)
+			if err != nil {
+				t.Fatalf("Failed to parse rule: %s", err)
+			}
+
+			isMatch := rule.Eval(nil, &input.tweet)
+			if isMatch != input.expected {
+				t.Errorf("Rule %s evaluated to %v, expected %v", input.rule, isMatch, input.expected)
+			}
+		})
+	}
+}
+
 func BenchmarkParser(b *testing.B) {
 	input := `((text !~ "hey!") && (likes == 5)) || created < 10-May-2020 || likes == 9`
 	parser := NewParser(input)
@@ -172,6 +560,6 @@ func BenchmarkEval(b *testing.B) {
 	b.ResetTimer()
 
 	for i := 0; i < b.N; i++ {
-		rule.Eval(&tweet)
+		rule.Eval(nil, &tweet)
 	}
 }
@@ -0,0 +1,103 @@
+package histweet
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"time"
+)
+
+const (
+	planExcerptLength = 100
+)
+
+// PlanEntry is a single tweet in a deletion Plan
+type PlanEntry struct {
+	ID          int64     `json:"id"`
+	CreatedAt   time.Time `json:"created_at"`
+	Text        string    `json:"text"`
+	NumLikes    int       `json:"likes"`
+	NumRetweets int       `json:"retweets"`
+	MatchedRule string    `json:"matched_rule,omitempty"`
+}
+
+// Plan is a list of tweets to delete that can be written to a file,
+// reviewed by a human, and then applied at a later point in time.
+type Plan struct {
+	CreatedAt time.Time   `json:"created_at"`
+	Rules     []string    `json:"rules"`
+	Tweets    []PlanEntry `json:"tweets"`
+}
+
+// NewPlan builds a Plan to delete the given tweets, which were matched by
+// the given Rule
+func NewPlan(rule *Rule, tweets []Tweet) *Plan {
+	plan := &Plan{
+		CreatedAt: time.Now().UTC(),
+		Rules:     rule.Describe(),
+		Tweets:    make([]PlanEntry, 0, len(tweets)),
+	}
+
+	for _, tweet := range tweets {
+		entry := PlanEntry{
+			ID:          tweet.ID,
+			CreatedAt:   tweet.CreatedAt,
+			Text:        tweet.Excerpt(planExcerptLength),
+			NumLikes:    tweet.NumLikes,
+			NumRetweets: tweet.NumRetweets,
+			MatchedRule: tweet.MatchedRule,
+		}
+
+		plan.Tweets = append(plan.Tweets, entry)
+	}
+
+	return plan
+}
+
+// ReadPlan reads a Plan from the file at the given path
+func ReadPlan(path string) (*Plan, error) {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &Plan{}
+
+	err = json.Unmarshal(buf, plan)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid plan file %s: %w", path, err)
+	}
+
+	return plan, nil
+}
+
+// Write writes this Plan to a file at the given path as JSON
+func (plan *Plan) Write(path string) error {
+	buf, err := json.MarshalIndent(plan, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, buf, 0644)
+}
+
+// ToTweets returns the tweets in this Plan, e.g., to pass to DeleteTweets.
+// Only the fields stored in the plan are set on each tweet.
+func (plan *Plan) ToTweets() []Tweet {
+	tweets := make([]Tweet, 0, len(plan.Tweets))
+
+	for _, entry := range plan.Tweets {
+		tweet := Tweet{
+			ID:          entry.ID,
+			CreatedAt:   entry.CreatedAt,
+			Text:        entry.Text,
+			NumLikes:    entry.NumLikes,
+			NumRetweets: entry.NumRetweets,
+			MatchedRule: entry.MatchedRule,
+		}
+
+		tweets = append(tweets, tweet)
+	}
+
+	return tweets
+}
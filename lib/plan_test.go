@@ -0,0 +1,82 @@
+package histweet
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPlan(t *testing.T) {
+	named, err := ParseRules("old: age > 30d\nunpopular: likes < 3")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rule := &Rule{Named: named}
+
+	tweets := []Tweet{
+		{
+			ID:          123,
+			CreatedAt:   time.Date(2020, 5, 10, 12, 0, 0, 0, time.UTC),
+			Text:        "Hello,\nworld!",
+			NumLikes:    2,
+			MatchedRule: "unpopular",
+		},
+		{
+			ID:          456,
+			Text:        strings.Repeat("a", 500),
+			NumRetweets: 10,
+			MatchedRule: "old",
+		},
+	}
+
+	dir, err := ioutil.TempDir("", "histweet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "plan.json")
+
+	err = NewPlan(rule, tweets).Write(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plan, err := ReadPlan(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(plan.Rules) != 2 || plan.Rules[0] != "old: age > 30d" {
+		t.Errorf("Unexpected rules in plan: %v", plan.Rules)
+	}
+
+	planned := plan.ToTweets()
+	if len(planned) != len(tweets) {
+		t.Fatalf("Plan has %d tweets, expected %d", len(planned), len(tweets))
+	}
+
+	if planned[0].ID != 123 || planned[0].Text != "Hello, world!" || planned[0].NumLikes != 2 ||
+		planned[0].MatchedRule != "unpopular" || !planned[0].CreatedAt.Equal(tweets[0].CreatedAt) {
+		t.Errorf("Unexpected tweet in plan: %+v", planned[0])
+	}
+
+	if planned[1].ID != 456 || len(planned[1].Text) != planExcerptLength || planned[1].NumRetweets != 10 {
+		t.Errorf("Unexpected tweet in plan: %+v", planned[1])
+	}
+
+	// Invalid plans
+	_, err = ReadPlan(filepath.Join(dir, "missing.json"))
+	if err == nil {
+		t.Errorf("Expected an error for a missing plan")
+	}
+
+	_, err = ReadPlan("sample_archive.js")
+	if err == nil {
+		t.Errorf("Expected an error for an invalid plan")
+	}
+}
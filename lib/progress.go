@@ -0,0 +1,65 @@
+package histweet
+
+import (
+	"time"
+)
+
+// EventKind is the kind of a progress Event
+type EventKind int
+
+// Kinds of progress events
+const (
+	// A page of tweets was fetched from the timeline or read from an archive
+	EventPageFetched EventKind = iota
+
+	// A tweet matched the rule(s)
+	EventTweetMatched
+
+	// A tweet was deleted
+	EventTweetDeleted
+
+	// A tweet could not be deleted
+	EventTweetFailed
+
+	// The rate limit was exhausted, so we are waiting for it to reset
+	EventRateLimitWait
+)
+
+// Event reports progress while fetching or deleting tweets
+type Event struct {
+	Kind EventKind
+
+	// Tweet this event refers to, if any
+	Tweet *Tweet
+
+	// Number of tweets in the fetched page
+	Count int
+
+	// Error that caused a tweet to fail
+	Err error
+
+	// How long we are going to wait for the rate limit to reset
+	Wait time.Duration
+}
+
+// Observer is notified of progress events while fetching or deleting tweets.
+// Since tweets can be deleted in parallel, an Observer may be called from
+// multiple goroutines at the same time.
+type Observer interface {
+	OnEvent(event *Event)
+}
+
+// ObserverFunc adapts an ordinary function to the Observer interface
+type ObserverFunc func(event *Event)
+
+// OnEvent calls f(event)
+func (f ObserverFunc) OnEvent(event *Event) {
+	f(event)
+}
+
+// Notifies the given observer of an event, if an observer is set
+func notify(observer Observer, event *Event) {
+	if observer != nil {
+		observer.OnEvent(event)
+	}
+}
@@ -0,0 +1,78 @@
+package histweet
+
+import (
+	"sync"
+	"testing"
+)
+
+// Observer that counts each kind of event
+type countingObserver struct {
+	counts map[EventKind]int
+	mu     sync.Mutex
+}
+
+func newCountingObserver() *countingObserver {
+	return &countingObserver{counts: make(map[EventKind]int)}
+}
+
+func (o *countingObserver) OnEvent(event *Event) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.counts[event.Kind]++
+}
+
+func TestObserver(t *testing.T) {
+	tweetRule, _ := Parse(`likes >= 3 || text ~ "potato"`)
+	rule := &Rule{Tweet: tweetRule}
+
+	// Timeline
+	observer := newCountingObserver()
+
+	tweets, err := FetchTimelineTweets(rule, &mockTwitterClient{}, &FetchOptions{Observer: observer})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if observer.counts[EventPageFetched] != 1 || observer.counts[EventTweetMatched] != len(tweets) {
+		t.Errorf("Unexpected timeline events: %v", observer.counts)
+	}
+
+	// Archive
+	observer = newCountingObserver()
+
+	tweets, err = FetchArchiveTweets(rule, &FetchOptions{Observer: observer}, "sample_archive.js")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if observer.counts[EventPageFetched] != 1 || observer.counts[EventTweetMatched] != len(tweets) {
+		t.Errorf("Unexpected archive events: %v", observer.counts)
+	}
+
+	// Deletion
+	tweets = make([]Tweet, 20)
+	for i := range tweets {
+		tweets[i].ID = int64(i + 1)
+	}
+
+	observer = newCountingObserver()
+
+	_, err = DeleteTweets(tweets, &failingTwitterClient{}, &DeleteOptions{Concurrency: 4, Observer: observer})
+	if err == nil {
+		t.Errorf("Expected an error")
+	}
+
+	if observer.counts[EventTweetDeleted] != 18 || observer.counts[EventTweetFailed] != 2 {
+		t.Errorf("Unexpected deletion events: %v", observer.counts)
+	}
+
+	// Function observers
+	calls := 0
+	notify(ObserverFunc(func(event *Event) { calls++ }), &Event{Kind: EventRateLimitWait})
+	notify(nil, &Event{Kind: EventRateLimitWait})
+
+	if calls != 1 {
+		t.Errorf("Expected the observer function to be called once")
+	}
+}
@@ -0,0 +1,159 @@
+package histweet
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/dghubble/go-twitter/twitter"
+)
+
+const (
+	defaultMaxRetries = 5
+	defaultRetryDelay = time.Second
+
+	// Twitter API error code for "No status found with that ID"
+	errorCodeNoStatus = 144
+
+	// Twitter API rate limit headers
+	rateLimitRemainingHeader = "X-Rate-Limit-Remaining"
+	rateLimitResetHeader     = "X-Rate-Limit-Reset"
+)
+
+// retrier wraps calls to the Twitter API and handles throttling.
+//
+// If the API reports that the rate limit has been exhausted, the retrier sleeps
+// until the rate limit window resets before making the next call. Transient
+// errors (i.e., 5xx and network errors) are retried with exponential backoff.
+type retrier struct {
+	maxRetries int
+	baseDelay  time.Duration
+
+	// Time at which the current rate limit window resets, if the rate limit
+	// has been exhausted. A single retrier may be shared by multiple
+	// goroutines, which then share the same rate limit budget.
+	resumeAt time.Time
+	mu       sync.Mutex
+
+	// Notified whenever we wait for the rate limit to reset
+	observer Observer
+
+	// Overridden in tests
+	sleep func(time.Duration)
+	now   func() time.Time
+}
+
+func newRetrier(observer Observer) *retrier {
+	return &retrier{
+		maxRetries: defaultMaxRetries,
+		baseDelay:  defaultRetryDelay,
+		observer:   observer,
+		sleep:      time.Sleep,
+		now:        time.Now,
+	}
+}
+
+// Sleeps until the current rate limit window resets, if needed
+func (r *retrier) wait() {
+	r.mu.Lock()
+	delay := r.resumeAt.Sub(r.now())
+	r.mu.Unlock()
+
+	if delay > 0 {
+		notify(r.observer, &Event{Kind: EventRateLimitWait, Wait: delay})
+		r.sleep(delay)
+	}
+}
+
+// Reads the rate limit headers from the given response. Returns true if the
+// rate limit has been exhausted and the window has not reset yet.
+func (r *retrier) update(resp *http.Response) bool {
+	if resp == nil {
+		return false
+	}
+
+	remaining := resp.Header.Get(rateLimitRemainingHeader)
+	if resp.StatusCode != http.StatusTooManyRequests && remaining != "0" {
+		return false
+	}
+
+	reset, err := strconv.ParseInt(resp.Header.Get(rateLimitResetHeader), 10, 64)
+	if err != nil {
+		return false
+	}
+
+	resumeAt := time.Unix(reset, 0)
+
+	r.mu.Lock()
+	if resumeAt.After(r.resumeAt) {
+		r.resumeAt = resumeAt
+	}
+	r.mu.Unlock()
+
+	return resumeAt.After(r.now())
+}
+
+// Returns the delay before the given retry attempt (starting at 0)
+func (r *retrier) backoff(attempt int) time.Duration {
+	return r.baseDelay * time.Duration(1<<uint(attempt))
+}
+
+// Calls fn until it succeeds, a non-retryable error is returned, or the
+// maximum number of retries is exceeded
+func (r *retrier) call(fn func() (*http.Response, error)) (*http.Response, error) {
+	attempt := 0
+
+	for {
+		r.wait()
+
+		resp, err := fn()
+		isLimited := r.update(resp)
+
+		if err == nil {
+			return resp, nil
+		}
+
+		// If we know when the rate limit window resets, wait for it without
+		// counting it as a retry
+		if isLimited && resp.StatusCode == http.StatusTooManyRequests {
+			continue
+		}
+
+		if !isTransientError(resp) || attempt >= r.maxRetries {
+			return resp, err
+		}
+
+		r.sleep(r.backoff(attempt))
+		attempt++
+	}
+}
+
+// Returns true if the request that returned the given response should be
+// retried. A missing response indicates a network error.
+func isTransientError(resp *http.Response) bool {
+	if resp == nil {
+		return true
+	}
+
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+}
+
+// Returns true if the given error indicates that the tweet no longer exists
+func isNotFoundError(resp *http.Response, err error) bool {
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		return true
+	}
+
+	var apiErr twitter.APIError
+	if errors.As(err, &apiErr) {
+		for _, detail := range apiErr.Errors {
+			if detail.Code == errorCodeNoStatus {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,170 @@
+package histweet
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/dghubble/go-twitter/twitter"
+)
+
+// Builds a retrier with a fake clock that advances on every sleep
+func newTestRetrier() (*retrier, *[]time.Duration) {
+	now := time.Date(2020, 5, 10, 0, 0, 0, 0, time.UTC)
+	var sleeps []time.Duration
+
+	r := newRetrier(nil)
+	r.now = func() time.Time {
+		return now
+	}
+	r.sleep = func(d time.Duration) {
+		sleeps = append(sleeps, d)
+		now = now.Add(d)
+	}
+
+	return r, &sleeps
+}
+
+func newTestResponse(status int, remaining int, reset time.Time) *http.Response {
+	resp := &http.Response{
+		StatusCode: status,
+		Header:     make(http.Header),
+	}
+
+	resp.Header.Set(rateLimitRemainingHeader, strconv.Itoa(remaining))
+	resp.Header.Set(rateLimitResetHeader, strconv.FormatInt(reset.Unix(), 10))
+
+	return resp
+}
+
+func TestRetrierRateLimit(t *testing.T) {
+	r, sleeps := newTestRetrier()
+	reset := r.now().Add(15 * time.Minute)
+
+	observer := newCountingObserver()
+	r.observer = observer
+
+	calls := 0
+
+	_, err := r.call(func() (*http.Response, error) {
+		calls++
+
+		if calls == 1 {
+			return newTestResponse(http.StatusTooManyRequests, 0, reset), fmt.Errorf("rate limited")
+		}
+
+		return newTestResponse(http.StatusOK, 10, reset), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if calls != 2 || len(*sleeps) != 1 || (*sleeps)[0] != 15*time.Minute {
+		t.Errorf("Unexpected calls (%d) or sleeps (%v)", calls, *sleeps)
+	}
+
+	// If the rate limit is exhausted, the next call waits for the window to
+	// reset before calling the API
+	reset = r.now().Add(time.Minute)
+	*sleeps = nil
+
+	for i := 0; i < 2; i++ {
+		_, err = r.call(func() (*http.Response, error) {
+			return newTestResponse(http.StatusOK, 0, reset), nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(*sleeps) != 1 || (*sleeps)[0] != time.Minute {
+		t.Errorf("Unexpected sleeps: %v", *sleeps)
+	}
+
+	if observer.counts[EventRateLimitWait] != 2 {
+		t.Errorf("Expected 2 rate limit wait events, got %d", observer.counts[EventRateLimitWait])
+	}
+}
+
+func TestRetrierBackoff(t *testing.T) {
+	var inputs = []struct {
+		name           string
+		resp           *http.Response
+		expectedCalls  int
+		expectedSleeps []time.Duration
+	}{
+		{"server_error", &http.Response{StatusCode: http.StatusServiceUnavailable}, 6,
+			[]time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 16 * time.Second}},
+		{"network_error", nil, 6,
+			[]time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 16 * time.Second}},
+		{"rate_limit_no_reset", &http.Response{StatusCode: http.StatusTooManyRequests}, 6,
+			[]time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 16 * time.Second}},
+		{"client_error", &http.Response{StatusCode: http.StatusForbidden}, 1, nil},
+	}
+
+	for _, input := range inputs {
+		t.Run(input.name, func(t *testing.T) {
+			r, sleeps := newTestRetrier()
+			calls := 0
+
+			_, err := r.call(func() (*http.Response, error) {
+				calls++
+				return input.resp, fmt.Errorf("failed")
+			})
+			if err == nil {
+				t.Errorf("Expected an error")
+			}
+
+			if calls != input.expectedCalls {
+				t.Errorf("Made %d calls, expected %d", calls, input.expectedCalls)
+			}
+
+			if fmt.Sprint(*sleeps) != fmt.Sprint(input.expectedSleeps) {
+				t.Errorf("Slept for %v, expected %v", *sleeps, input.expectedSleeps)
+			}
+		})
+	}
+
+	// Transient errors that eventually succeed
+	r, sleeps := newTestRetrier()
+	calls := 0
+
+	_, err := r.call(func() (*http.Response, error) {
+		calls++
+
+		if calls < 3 {
+			return &http.Response{StatusCode: http.StatusBadGateway}, fmt.Errorf("failed")
+		}
+
+		return &http.Response{StatusCode: http.StatusOK}, nil
+	})
+	if err != nil || calls != 3 || len(*sleeps) != 2 {
+		t.Errorf("Unexpected result: err = %v, calls = %d, sleeps = %v", err, calls, *sleeps)
+	}
+}
+
+func TestIsNotFoundError(t *testing.T) {
+	var inputs = []struct {
+		name     string
+		resp     *http.Response
+		err      error
+		expected bool
+	}{
+		{"not_found", &http.Response{StatusCode: http.StatusNotFound}, errors.New("failed"), true},
+		{"no_status", nil, twitter.APIError{Errors: []twitter.ErrorDetail{{Code: errorCodeNoStatus}}}, true},
+		{"other_code", &http.Response{StatusCode: http.StatusForbidden},
+			twitter.APIError{Errors: []twitter.ErrorDetail{{Code: 63}}}, false},
+		{"network_error", nil, errors.New("failed"), false},
+	}
+
+	for _, input := range inputs {
+		t.Run(input.name, func(t *testing.T) {
+			if isNotFoundError(input.resp, input.err) != input.expected {
+				t.Errorf("Expected %v for %v", input.expected, input.err)
+			}
+		})
+	}
+}
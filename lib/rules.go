@@ -1,6 +1,7 @@
 package histweet
 
 import (
+	"fmt"
 	"regexp"
 	"time"
 )
@@ -8,14 +9,39 @@ import (
 type ruleComparator int
 
 const (
-	comparatorGt ruleComparator = iota
+	comparatorNone ruleComparator = iota
+	comparatorGt
 	comparatorGte
 	comparatorLt
 	comparatorLte
 	comparatorEq
 	comparatorNeq
+	comparatorIn
 )
 
+// Boolean attributes of a tweet that can be checked by a rule
+type tweetAttribute int
+
+const (
+	attributeNone tweetAttribute = iota
+	attributeRetweet
+	attributeReply
+	attributeQuote
+	attributeMedia
+	attributeLink
+	attributeThread
+)
+
+// Maps rule identifiers to the boolean tweet attribute they refer to
+var attributeIdents = map[string]tweetAttribute{
+	"is_retweet": attributeRetweet,
+	"is_reply":   attributeReply,
+	"is_quote":   attributeQuote,
+	"has_media":  attributeMedia,
+	"has_link":   attributeLink,
+	"is_thread":  attributeThread,
+}
+
 // RuleCount keeps the N latest tweets.
 // If `Latest` is set to `true`, delete the N latest tweets
 type RuleCount struct {
@@ -23,16 +49,134 @@ type RuleCount struct {
 	Latest bool
 }
 
+// Age is a relative age, e.g., "1y3d". Years, months, and days are calendar
+// units, so they are kept separate from the fixed Duration.
+type Age struct {
+	Years    int
+	Months   int
+	Days     int
+	Duration time.Duration
+}
+
+// Before returns the time that is this age relative to the given time
+func (age Age) Before(t time.Time) time.Time {
+	// This is how you go back in time
+	return t.AddDate(-age.Years, -age.Months, -age.Days).Add(-age.Duration)
+}
+
 // RuleTweet checks each Tweet against a set of conditions
 type RuleTweet struct {
-	Before             time.Time
-	After              time.Time
-	Match              *regexp.Regexp
-	IsNegativeMatch    bool
-	Likes              int
-	LikesComparator    ruleComparator
-	Retweets           int
-	RetweetsComparator ruleComparator
+	// The age of a tweet is resolved against the current time when the rule
+	// is evaluated
+	Age           Age
+	AgeComparator ruleComparator
+
+	Match                *regexp.Regexp
+	IsNegativeMatch      bool
+	Likes                int
+	LikesComparator      ruleComparator
+	Retweets             int
+	RetweetsComparator   ruleComparator
+	Replies              int
+	RepliesComparator    ruleComparator
+	Quotes               int
+	QuotesComparator     ruleComparator
+	Engagement           int
+	EngagementComparator ruleComparator
+	Attribute            tweetAttribute
+	AttributeValue       bool
+
+	// Dates or datetimes in a "created" condition, which are resolved in the
+	// location of the EvalContext. A single time is a range of itself.
+	Created           string
+	CreatedUntil      string
+	CreatedComparator ruleComparator
+
+	// Hour of the day and day of the week that a tweet was created, in the
+	// location of the EvalContext. The upper bounds are only used by ranges.
+	Hour              int
+	HourUntil         int
+	HourComparator    ruleComparator
+	Weekday           time.Weekday
+	WeekdayUntil      time.Weekday
+	WeekdayComparator ruleComparator
+
+	// Follower count of the account in the EvalContext
+	Followers           int
+	FollowersComparator ruleComparator
+}
+
+// Compares a tweet's count (e.g., number of likes) to the count in a rule
+func compareCount(val int, target int, comparator ruleComparator) bool {
+	switch comparator {
+	case comparatorGt:
+		return val > target
+	case comparatorGte:
+		return val >= target
+	case comparatorLt:
+		return val < target
+	case comparatorLte:
+		return val <= target
+	case comparatorEq:
+		return val == target
+	case comparatorNeq:
+		return val != target
+	default:
+		return false
+	}
+}
+
+// Compares a value that wraps around (e.g., the hour of the day) to the value
+// in a rule. For ranges, the value must be in [from, to], which may wrap
+// around as well: e.g., [22, 2] contains 23 and 1.
+func compareCyclic(val int, from int, to int, comparator ruleComparator) bool {
+	if comparator != comparatorIn {
+		return compareCount(val, from, comparator)
+	}
+
+	if from <= to {
+		return from <= val && val <= to
+	}
+
+	return val >= from || val <= to
+}
+
+// Compares a tweet's creation time to the time range [start, end) in a rule,
+// which stands for a single date or datetime
+func compareTime(val time.Time, start time.Time, end time.Time, comparator ruleComparator) bool {
+	switch comparator {
+	case comparatorGt:
+		return !val.Before(end)
+	case comparatorGte:
+		return !val.Before(start)
+	case comparatorLt:
+		return val.Before(start)
+	case comparatorLte:
+		return val.Before(end)
+	case comparatorEq:
+		return !val.Before(start) && val.Before(end)
+	case comparatorNeq:
+		return val.Before(start) || !val.Before(end)
+	default:
+		return false
+	}
+}
+
+// Compares a tweet's creation time to the time that is the age in a rule
+// (relative to now). Older tweets have a greater age.
+func compareAge(createdAt time.Time, threshold time.Time, comparator ruleComparator) bool {
+	switch comparator {
+	case comparatorGt:
+		return createdAt.Before(threshold)
+	case comparatorGte:
+		return !createdAt.After(threshold)
+	case comparatorLt:
+		return createdAt.After(threshold)
+	case comparatorLte:
+		return !createdAt.Before(threshold)
+	default:
+		return false
+	}
 }
 
 // Rule for what kind of tweets to delete
@@ -43,6 +187,79 @@ type Rule struct {
 	// Delete all tweets that match some tweet-based rules
 	Tweet *ParsedRule
 
+	// Delete all tweets that match any of these named rules
+	Named []*NamedRule
+
 	// Raw input rule
 	Input string
 }
+
+// Match checks the given Tweet against all tweet-based rules in the given
+// context. If the tweet matches a named rule, the name of the first such rule
+// is stored in the tweet's MatchedRule field.
+func (rule *Rule) Match(ctx *EvalContext, tweet *Tweet) bool {
+	ctx = ctx.resolve()
+
+	if rule.Tweet != nil && rule.Tweet.Eval(ctx, tweet) {
+		return true
+	}
+
+	for _, named := range rule.Named {
+		if named.Rule.Eval(ctx, tweet) {
+			tweet.MatchedRule = named.Name
+			return true
+		}
+	}
+
+	return false
+}
+
+// Fields whose conditions depend on the account in the EvalContext
+var accountFields = []string{"followers", "is_thread"}
+
+// NeedsAccount returns true if any of the tweet-based rules depends on the
+// account in the EvalContext (i.e., has a "followers" or "is_thread"
+// condition). The account only has to be fetched for such rules.
+func (rule *Rule) NeedsAccount() bool {
+	var rules []*ParsedRule
+
+	if rule.Tweet != nil {
+		rules = append(rules, rule.Tweet)
+	}
+
+	for _, named := range rule.Named {
+		rules = append(rules, named.Rule)
+	}
+
+	for _, parsed := range rules {
+		ast := parsed.AST()
+
+		for _, field := range accountFields {
+			if ast.HasField(field) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// Describe returns a human-readable description of each rule, with each
+// expression formatted by Format
+func (rule *Rule) Describe() []string {
+	var rules []string
+
+	if rule.Count != nil {
+		rules = append(rules, fmt.Sprintf("keep only the latest %d tweets", rule.Count.N))
+	}
+
+	if rule.Tweet != nil {
+		rules = append(rules, Format(rule.Tweet))
+	}
+
+	for _, named := range rule.Named {
+		rules = append(rules, fmt.Sprintf("%s: %s", named.Name, Format(named.Rule)))
+	}
+
+	return rules
+}
@@ -0,0 +1,239 @@
+package histweet
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strings"
+)
+
+// Matches the "name:" prefix that starts a new rule in a rules file
+var ruleNamePattern = regexp.MustCompile(`^\s*([A-Za-z_][A-Za-z0-9_-]*)\s*:`)
+
+// NamedRule is a single named tweet rule, e.g., loaded from a rules file
+type NamedRule struct {
+	Name  string
+	Input string
+	Rule  *ParsedRule
+}
+
+// Removes a trailing "#" comment from the given line. A "#" inside of
+// a string literal does not start a comment.
+func stripComment(line string) string {
+	inString := false
+
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case '\\':
+			// Skip over the escaped character
+			if inString {
+				i++
+			}
+		case '"':
+			inString = !inString
+		case '#':
+			if !inString {
+				return line[:i]
+			}
+		}
+	}
+
+	return line
+}
+
+// ParseRules parses the contents of a rules file.
+//
+// A rules file contains one or more named rules of the form "name: expr".
+// Expressions may span multiple lines, and everything following a "#" (outside
+// of a string) is treated as a comment. For example:
+//
+//	# Clean up old tweets that nobody cared about
+//	unpopular: age > 30d &&
+//	           likes < 3
+//
+//	typos: text ~ "teh"  # Embarrassing
+//
+// Errors in an expression are reported with the line and column of the
+// offending token in the rules file.
+func ParseRules(input string) ([]*NamedRule, error) {
+	var rules []*NamedRule
+
+	// Lines that make up the expression of each rule, and the line on which
+	// each rule starts
+	var exprLines [][]string
+	var startLines []int
+
+	for i, line := range strings.Split(input, "\n") {
+		line = stripComment(line)
+
+		if loc := ruleNamePattern.FindStringSubmatchIndex(line); loc != nil {
+			name := line[loc[2]:loc[3]]
+
+			rules = append(rules, &NamedRule{Name: name})
+			startLines = append(startLines, i)
+
+			// Blank out the rule name so that columns in the expression match
+			// the columns in the file
+			line = strings.Repeat(" ", loc[1]) + line[loc[1]:]
+			exprLines = append(exprLines, []string{line})
+
+			continue
+		}
+
+		if strings.TrimSpace(line) == "" {
+			// Keep blank lines inside of a rule to preserve line numbers
+			if len(exprLines) > 0 {
+				l := len(exprLines) - 1
+				exprLines[l] = append(exprLines[l], "")
+			}
+
+			continue
+		}
+
+		if len(rules) == 0 {
+			return nil, fmt.Errorf("Expected a rule name (\"name: expr\") at line %d", i+1)
+		}
+
+		l := len(exprLines) - 1
+		exprLines[l] = append(exprLines[l], line)
+	}
+
+	if len(rules) == 0 {
+		return nil, fmt.Errorf("No rules found")
+	}
+
+	seen := make(map[string]bool)
+
+	for i, rule := range rules {
+		if seen[rule.Name] {
+			return nil, fmt.Errorf("Duplicate rule name \"%s\" at line %d", rule.Name, startLines[i]+1)
+		}
+
+		seen[rule.Name] = true
+
+		expr := strings.Join(exprLines[i], "\n")
+		if strings.TrimSpace(expr) == "" {
+			return nil, fmt.Errorf("Rule \"%s\" at line %d is empty", rule.Name, startLines[i]+1)
+		}
+
+		parsed, err := Parse(expr)
+		if err != nil {
+			// Convert the error position to a position in the file
+			var parserErr *ParserError
+			if errors.As(err, &parserErr) {
+				parserErr.line += startLines[i]
+			}
+
+			return nil, fmt.Errorf("Invalid rule \"%s\": %w", rule.Name, err)
+		}
+
+		// Store the expression on a single line for display purposes
+		var parts []string
+		for _, line := range exprLines[i] {
+			if line = strings.TrimSpace(line); line != "" {
+				parts = append(parts, line)
+			}
+		}
+
+		rule.Input = strings.Join(parts, " ")
+		rule.Rule = parsed
+	}
+
+	return rules, nil
+}
+
+// ParseRulesFile reads and parses the rules file at the given path.
+// Refer to ParseRules for the file format.
+func ParseRulesFile(path string) ([]*NamedRule, error) {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseRules(string(buf))
+}
+
+// FormatRules formats the contents of a rules file, putting each rule on a
+// single line formatted by Format.
+//
+// Comments and blank lines between rules are kept as-is. Comments inside of a
+// multi-line rule are moved above the rule, and trailing comments are kept at
+// the end of the rule's line.
+func FormatRules(input string) (string, error) {
+	rules, err := ParseRules(input)
+	if err != nil {
+		return "", err
+	}
+
+	lines := strings.Split(input, "\n")
+
+	// Index of the rule that each line belongs to, and the last line that
+	// contains part of each rule
+	ruleOf := make([]int, len(lines))
+	lastLines := make([]int, len(rules))
+
+	curr := -1
+
+	for i, line := range lines {
+		code := stripComment(line)
+
+		if ruleNamePattern.MatchString(code) {
+			curr++
+		}
+
+		ruleOf[i] = curr
+
+		if curr >= 0 && strings.TrimSpace(code) != "" {
+			lastLines[curr] = i
+		}
+	}
+
+	var output strings.Builder
+
+	// Comments found in the current rule
+	var above []string
+	var trailing []string
+
+	for i, line := range lines {
+		curr := ruleOf[i]
+
+		if curr < 0 || i > lastLines[curr] {
+			output.WriteString(strings.TrimRight(line, " \t\r") + "\n")
+			continue
+		}
+
+		code := stripComment(line)
+		comment := strings.TrimSpace(line[len(code):])
+
+		if comment != "" {
+			if strings.TrimSpace(code) == "" {
+				above = append(above, comment)
+			} else {
+				trailing = append(trailing, comment)
+			}
+		}
+
+		if i < lastLines[curr] {
+			continue
+		}
+
+		for _, comment := range above {
+			output.WriteString(comment + "\n")
+		}
+
+		rule := rules[curr]
+		output.WriteString(rule.Name + ": " + Format(rule.Rule))
+
+		if len(trailing) > 0 {
+			output.WriteString("  " + strings.Join(trailing, " "))
+		}
+
+		output.WriteString("\n")
+
+		above = nil
+		trailing = nil
+	}
+
+	return strings.TrimRight(output.String(), "\n") + "\n", nil
+}
@@ -0,0 +1,108 @@
+package histweet
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseRules(t *testing.T) {
+	input := `
+# Clean up old tweets that nobody cared about
+unpopular: age > 30d &&
+           likes < 3   # Likes are a proxy for quality
+
+# Multiple lines, with a comment in between
+typos: text ~ "teh" ||
+       # Another common one
+       text ~ "#recieve"
+`
+
+	rules, err := ParseRules(input)
+	if err != nil {
+		t.Fatalf("Failed to parse rules: %s", err)
+	}
+
+	expected := []struct {
+		name  string
+		input string
+	}{
+		{"unpopular", "age > 30d && likes < 3"},
+		{"typos", `text ~ "teh" || text ~ "#recieve"`},
+	}
+
+	if len(rules) != len(expected) {
+		t.Fatalf("Parsed %d rules, expected %d", len(rules), len(expected))
+	}
+
+	for i, rule := range rules {
+		if rule.Name != expected[i].name {
+			t.Errorf("Rule name %s != expected %s", rule.Name, expected[i].name)
+		}
+
+		if rule.Input != expected[i].input {
+			t.Errorf("Rule input %s != expected %s", rule.Input, expected[i].input)
+		}
+	}
+
+	r := &Rule{Named: rules}
+
+	tweet := Tweet{Text: "I will #recieve it", NumLikes: 10}
+	if !r.Match(nil, &tweet) || tweet.MatchedRule != "typos" {
+		t.Errorf("Expected tweet to match rule \"typos\", matched \"%s\"", tweet.MatchedRule)
+	}
+
+	tweet = Tweet{Text: "abc", NumLikes: 10}
+	if r.Match(nil, &tweet) {
+		t.Errorf("Expected tweet to not match any rule")
+	}
+}
+
+func TestParseRulesErrors(t *testing.T) {
+	var inputs = []struct {
+		input string
+		line  int
+		col   int
+	}{
+		{"a: likes > 3 &&\n   likes ** 3", 2, 10},
+		{"# Comment\n\na: likes > 3\nb: likes >\n   3 &&\n", 5, 8},
+		{"a: likes > 3\nb: likes > 3 likes < 5", 2, 14},
+		{"a: (likes > 3", 1, 4},
+	}
+
+	for _, input := range inputs {
+		t.Run(input.input, func(t *testing.T) {
+			_, err := ParseRules(input.input)
+			if err == nil {
+				t.Fatalf("Expected an error")
+			}
+
+			var parserErr *ParserError
+			if !errors.As(err, &parserErr) {
+				t.Fatalf("Expected a ParserError, got: %s", err)
+			}
+
+			if parserErr.line != input.line || parserErr.col != input.col {
+				t.Errorf("Error at line %d, col %d, expected line %d, col %d -- %s",
+					parserErr.line, parserErr.col, input.line, input.col, err)
+			}
+		})
+	}
+
+	// Errors that are not tied to an expression
+	invalid := []string{
+		"",
+		"# Only a comment",
+		"likes > 3",
+		"a:\nb: likes > 3",
+		"a: likes > 3\na: likes < 3",
+	}
+
+	for _, input := range invalid {
+		t.Run(input, func(t *testing.T) {
+			_, err := ParseRules(input)
+			if err == nil {
+				t.Errorf("Expected an error")
+			}
+		})
+	}
+}
@@ -14,4 +14,21 @@ window.YTD.tweet.part0 = [ {
     "created_at" : "Wed Jul 01 03:59:54 +0000 2020",
     "full_text" : "RT Potato 12345"
   }
+}, {
+  "tweet" : {
+    "favorite_count" : "1",
+    "retweet_count" : "0",
+    "id" : "13141516",
+    "in_reply_to_status_id_str" : "1234567",
+    "created_at" : "Thu Jul 02 10:15:00 +0000 2020",
+    "full_text" : "@EmilyKager Same here https://t.co/abc https://t.co/xyz",
+    "entities" : {
+      "urls" : [ {
+        "expanded_url" : "https://twitter.com/EmilyKager/status/1234567"
+      } ],
+      "media" : [ {
+        "expanded_url" : "https://twitter.com/aksiksi/status/13141516/photo/1"
+      } ]
+    }
+  }
 } ]
\ No newline at end of file
@@ -3,6 +3,8 @@ package histweet
 import (
 	"fmt"
 	"net/http"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/dghubble/go-twitter/twitter"
@@ -21,8 +23,19 @@ type Tweet struct {
 	NumLikes    int
 	NumRetweets int
 	NumReplies  int
+	NumQuotes   int
 	IsRetweet   bool
 	IsReply     bool
+	IsQuote     bool
+	HasMedia    bool
+	HasLink     bool
+
+	// Tweet and user that this tweet replies to, if it is a reply
+	InReplyToStatusID int64
+	InReplyToUserID   int64
+
+	// Name of the named rule that matched this tweet, if any
+	MatchedRule string
 }
 
 // Interfaces that wrap the required Twitter API services.
@@ -65,8 +78,14 @@ func (t *TwitterClient) statusService() twitterStatusService {
 	return t.Client.Statuses
 }
 
-// IsMatch returns true if this tweet matches all set fields in the given rule.
-func (tweet *Tweet) IsMatch(rule *RuleTweet) bool {
+// IsMatch returns true if this tweet matches all set fields in the given rule,
+// in the given context
+func (tweet *Tweet) IsMatch(ctx *EvalContext, rule *RuleTweet) bool {
+	return tweet.isMatch(ctx.resolve(), rule)
+}
+
+// Like IsMatch, but the context must already be resolved
+func (tweet *Tweet) isMatch(ctx *EvalContext, rule *RuleTweet) bool {
 	if rule == nil {
 		return false
 	}
@@ -74,12 +93,31 @@ func (tweet *Tweet) IsMatch(rule *RuleTweet) bool {
 	createdAt := tweet.CreatedAt
 	isMatch := true
 
-	if !rule.Before.IsZero() {
-		isMatch = isMatch && createdAt.Before(rule.Before)
+	if rule.AgeComparator != comparatorNone {
+		isMatch = isMatch && compareAge(createdAt, rule.Age.Before(ctx.Now), rule.AgeComparator)
+	}
+
+	if rule.CreatedComparator != comparatorNone {
+		start, _, err := parseTimeRange(rule.Created, ctx.Location)
+		_, end, errUntil := parseTimeRange(rule.CreatedUntil, ctx.Location)
+
+		isMatch = isMatch && err == nil && errUntil == nil &&
+			compareTime(createdAt, start, end, rule.CreatedComparator)
 	}
 
-	if !rule.After.IsZero() {
-		isMatch = isMatch && createdAt.After(rule.Before)
+	local := createdAt.In(ctx.Location)
+
+	if rule.HourComparator != comparatorNone {
+		isMatch = isMatch && compareCyclic(local.Hour(), rule.Hour, rule.HourUntil, rule.HourComparator)
+	}
+
+	if rule.WeekdayComparator != comparatorNone {
+		isMatch = isMatch && compareCyclic(int(local.Weekday()), int(rule.Weekday), int(rule.WeekdayUntil), rule.WeekdayComparator)
+	}
+
+	if rule.FollowersComparator != comparatorNone {
+		isMatch = isMatch && ctx.Account != nil &&
+			compareCount(ctx.Account.Followers, rule.Followers, rule.FollowersComparator)
 	}
 
 	if rule.Match != nil {
@@ -93,51 +131,75 @@ func (tweet *Tweet) IsMatch(rule *RuleTweet) bool {
 		isMatch = isMatch && reMatch
 	}
 
-	if rule.Likes > 0 {
-		match := false
-
-		switch rule.LikesComparator {
-		case comparatorGt:
-			match = tweet.NumLikes > rule.Likes
-		case comparatorGte:
-			match = tweet.NumLikes >= rule.Likes
-		case comparatorLt:
-			match = tweet.NumLikes < rule.Likes
-		case comparatorLte:
-			match = tweet.NumLikes <= rule.Likes
-		case comparatorEq:
-			match = tweet.NumLikes == rule.Likes
-		case comparatorNeq:
-			match = tweet.NumLikes != rule.Likes
-		}
+	if rule.LikesComparator != comparatorNone {
+		isMatch = isMatch && compareCount(tweet.NumLikes, rule.Likes, rule.LikesComparator)
+	}
 
-		isMatch = isMatch && match
-	}
-
-	if rule.Retweets > 0 {
-		match := false
-
-		switch rule.RetweetsComparator {
-		case comparatorGt:
-			match = tweet.NumRetweets > rule.Retweets
-		case comparatorGte:
-			match = tweet.NumRetweets >= rule.Retweets
-		case comparatorLt:
-			match = tweet.NumRetweets < rule.Retweets
-		case comparatorLte:
-			match = tweet.NumRetweets <= rule.Retweets
-		case comparatorEq:
-			match = tweet.NumRetweets == rule.Retweets
-		case comparatorNeq:
-			match = tweet.NumRetweets != rule.Retweets
-		}
+	if rule.RetweetsComparator != comparatorNone {
+		isMatch = isMatch && compareCount(tweet.NumRetweets, rule.Retweets, rule.RetweetsComparator)
+	}
+
+	if rule.RepliesComparator != comparatorNone {
+		isMatch = isMatch && compareCount(tweet.NumReplies, rule.Replies, rule.RepliesComparator)
+	}
+
+	if rule.QuotesComparator != comparatorNone {
+		isMatch = isMatch && compareCount(tweet.NumQuotes, rule.Quotes, rule.QuotesComparator)
+	}
+
+	if rule.EngagementComparator != comparatorNone {
+		isMatch = isMatch && compareCount(tweet.Engagement(), rule.Engagement, rule.EngagementComparator)
+	}
+
+	if rule.Attribute != attributeNone {
+		// Like "followers", threads are unknown without an account
+		known := rule.Attribute != attributeThread || ctx.Account != nil
 
-		isMatch = isMatch && match
+		isMatch = isMatch && known && tweet.attribute(ctx, rule.Attribute) == rule.AttributeValue
 	}
 
 	return isMatch
 }
 
+// Excerpt returns a single-line excerpt of this tweet's text that is at most
+// n characters long
+func (tweet *Tweet) Excerpt(n int) string {
+	text := strings.Join(strings.Fields(tweet.Text), " ")
+
+	runes := []rune(text)
+	if len(runes) <= n {
+		return text
+	}
+
+	return string(runes[:n-3]) + "..."
+}
+
+// Engagement returns the total number of likes, retweets, and replies
+func (tweet *Tweet) Engagement() int {
+	return tweet.NumLikes + tweet.NumRetweets + tweet.NumReplies
+}
+
+// Returns the value of the given boolean attribute for this tweet in the
+// given (resolved) context
+func (tweet *Tweet) attribute(ctx *EvalContext, attr tweetAttribute) bool {
+	switch attr {
+	case attributeRetweet:
+		return tweet.IsRetweet
+	case attributeReply:
+		return tweet.IsReply
+	case attributeQuote:
+		return tweet.IsQuote
+	case attributeMedia:
+		return tweet.HasMedia
+	case attributeLink:
+		return tweet.HasLink
+	case attributeThread:
+		return tweet.IsReply && ctx.Account != nil && tweet.InReplyToUserID == ctx.Account.ID
+	default:
+		return false
+	}
+}
+
 // Convert an API tweet to internal tweet struct
 func convertAPITweet(from *twitter.Tweet) Tweet {
 	createdAt, _ := from.CreatedAtTime()
@@ -148,8 +210,23 @@ func convertAPITweet(from *twitter.Tweet) Tweet {
 		Text:        from.Text,
 		NumLikes:    from.FavoriteCount,
 		NumRetweets: from.RetweetCount,
+		NumReplies:  from.ReplyCount,
+		NumQuotes:   from.QuoteCount,
 		IsRetweet:   from.RetweetedStatus != nil,
 		IsReply:     from.InReplyToStatusID != 0,
+		IsQuote:     from.QuotedStatus != nil || from.QuotedStatusID != 0,
+
+		InReplyToStatusID: from.InReplyToStatusID,
+		InReplyToUserID:   from.InReplyToUserID,
+	}
+
+	if from.Entities != nil {
+		tweet.HasMedia = len(from.Entities.Media) > 0
+		tweet.HasLink = len(from.Entities.Urls) > 0
+	}
+
+	if from.ExtendedEntities != nil {
+		tweet.HasMedia = tweet.HasMedia || len(from.ExtendedEntities.Media) > 0
 	}
 
 	return tweet
@@ -187,13 +264,66 @@ func NewTwitterClient(
 	return client, nil
 }
 
+// FetchAccount looks up the account that the client is authenticated as.
+// Rate limits and transient errors are retried.
+func FetchAccount(client twitterClientAPI) (*Account, error) {
+	return fetchAccount(client, newRetrier(nil))
+}
+
+func fetchAccount(client twitterClientAPI, retrier *retrier) (*Account, error) {
+	params := &twitter.AccountVerifyParams{
+		SkipStatus: twitter.Bool(true),
+	}
+
+	var user *twitter.User
+
+	_, err := retrier.call(func() (*http.Response, error) {
+		var resp *http.Response
+		var err error
+
+		user, resp, err = client.accountService().VerifyCredentials(params)
+
+		return resp, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to fetch account: %s", err.Error())
+	}
+
+	if user == nil {
+		return nil, fmt.Errorf("Failed to fetch account: no user returned")
+	}
+
+	account := &Account{
+		ID:         user.ID,
+		ScreenName: user.ScreenName,
+		Followers:  user.FollowersCount,
+	}
+
+	return account, nil
+}
+
+// FetchOptions configures how tweets are fetched from the timeline or archive
+type FetchOptions struct {
+	// If set, notified as pages are fetched and tweets are matched
+	Observer Observer
+
+	// Context that the rule is evaluated in. If its time is not set, all
+	// tweets are evaluated against the time at which fetching started.
+	Context *EvalContext
+}
+
 // FetchTimelineTweets collects all timeline tweets for a given user that match
 // the provided `Rule`.
 //
-// This function sequentially calls the Twitter user timeline API without any
-// throttling.
-func FetchTimelineTweets(rule *Rule, client twitterClientAPI) ([]Tweet, error) {
-	// TODO: Handle throttling gracefully here
+// This function sequentially calls the Twitter user timeline API. If the rate
+// limit is hit, it waits for the rate limit window to reset before continuing.
+func FetchTimelineTweets(rule *Rule, client twitterClientAPI, opts *FetchOptions) ([]Tweet, error) {
+	if opts == nil {
+		opts = &FetchOptions{}
+	}
+
+	ctx := opts.Context.resolve()
+	retrier := newRetrier(opts.Observer)
 	validCount := 0
 	totalCount := 0
 	tweets := make([]Tweet, 0, maxTimelineTweets)
@@ -210,11 +340,22 @@ func FetchTimelineTweets(rule *Rule, client twitterClientAPI) ([]Tweet, error) {
 		timelineParams.MaxID = maxID
 
 		// Fetch a set of tweets (max. 200)
-		returnedTweets, _, err := client.timelineService().UserTimeline(timelineParams)
+		var returnedTweets []twitter.Tweet
+
+		_, err := retrier.call(func() (*http.Response, error) {
+			var resp *http.Response
+			var err error
+
+			returnedTweets, resp, err = client.timelineService().UserTimeline(timelineParams)
+
+			return resp, err
+		})
 		if err != nil {
 			return nil, fmt.Errorf("Something went wrong while fetching timeline tweets: %s", err.Error())
 		}
 
+		notify(opts.Observer, &Event{Kind: EventPageFetched, Count: len(returnedTweets)})
+
 		if rule.Count != nil {
 			n := rule.Count.N
 
@@ -230,6 +371,8 @@ func FetchTimelineTweets(rule *Rule, client twitterClientAPI) ([]Tweet, error) {
 				for _, tweet := range returnedTweets[startIdx:] {
 					converted := convertAPITweet(&tweet)
 					tweets = append(tweets, converted)
+
+					notify(opts.Observer, &Event{Kind: EventTweetMatched, Tweet: &converted})
 				}
 			}
 		} else {
@@ -237,14 +380,16 @@ func FetchTimelineTweets(rule *Rule, client twitterClientAPI) ([]Tweet, error) {
 			for _, tweet := range returnedTweets {
 				converted := convertAPITweet(&tweet)
 
-				// Evaluate the tweet against the parsed rule.
+				// Evaluate the tweet against the parsed rule(s).
 				// This walks the entire parse tree and ensures that all rules
 				// match.
-				match := rule.Tweet.Eval(&converted)
+				match := rule.Match(ctx, &converted)
 
 				if match {
 					tweets = append(tweets, converted)
 					validCount++
+
+					notify(opts.Observer, &Event{Kind: EventTweetMatched, Tweet: &converted})
 				}
 			}
 		}
@@ -264,15 +409,129 @@ func FetchTimelineTweets(rule *Rule, client twitterClientAPI) ([]Tweet, error) {
 	return tweets, nil
 }
 
+// DeleteOptions configures how DeleteTweets deletes tweets
+type DeleteOptions struct {
+	// If set, each deleted tweet is recorded in this journal, and tweets
+	// that are already in the journal are skipped
+	Journal *Journal
+
+	// Maximum number of tweets to delete in parallel (default: 1)
+	Concurrency int
+
+	// If set, notified as tweets are deleted
+	Observer Observer
+}
+
+// DeleteResult summarizes the outcome of a call to DeleteTweets
+type DeleteResult struct {
+	// Number of tweets that were deleted
+	Deleted int
+
+	// Number of tweets that were skipped because they are in the journal
+	Skipped int
+
+	// Errors for all tweets that could not be deleted, keyed by tweet ID
+	Failed map[int64]error
+}
+
+// Outcome of deleting a single tweet
+type deleteOutcome struct {
+	tweet *Tweet
+	err   error
+}
+
+// Deletes a single tweet and records it in the journal (if any)
+func deleteTweet(tweet *Tweet, client twitterClientAPI, retrier *retrier, journal *Journal) error {
+	resp, err := retrier.call(func() (*http.Response, error) {
+		_, resp, err := client.statusService().Destroy(tweet.ID, &twitter.StatusDestroyParams{})
+		return resp, err
+	})
+	if err != nil && !isNotFoundError(resp, err) {
+		return err
+	}
+
+	if journal != nil {
+		return journal.Record(tweet.ID)
+	}
+
+	return nil
+}
+
 // DeleteTweets deletes the provided list of tweets
-func DeleteTweets(tweets []Tweet, client twitterClientAPI) error {
-	// TODO: Handle throttling gracefully here
-	for _, tweet := range tweets {
-		_, _, err := client.statusService().Destroy(tweet.ID, &twitter.StatusDestroyParams{})
-		if err != nil {
-			return err
+//
+// Tweets are deleted by a pool of workers (see DeleteOptions.Concurrency)
+// that share the same rate limit budget. Rate limits and transient errors are
+// handled by waiting and retrying. Tweets that have already been deleted are
+// treated as a success.
+//
+// A failure to delete one tweet does not stop the deletion of the others. The
+// returned result contains the errors for all failed tweets; in that case, a
+// non-nil error is returned as well.
+func DeleteTweets(tweets []Tweet, client twitterClientAPI, opts *DeleteOptions) (*DeleteResult, error) {
+	if opts == nil {
+		opts = &DeleteOptions{}
+	}
+
+	concurrency := opts.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	result := &DeleteResult{
+		Failed: make(map[int64]error),
+	}
+
+	// Skip all tweets that are already in the journal
+	pending := tweets
+
+	if opts.Journal != nil {
+		pending = opts.Journal.Remaining(tweets)
+		result.Skipped = len(tweets) - len(pending)
+	}
+
+	retrier := newRetrier(opts.Observer)
+
+	jobs := make(chan *Tweet)
+	outcomes := make(chan deleteOutcome)
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for tweet := range jobs {
+				err := deleteTweet(tweet, client, retrier, opts.Journal)
+				outcomes <- deleteOutcome{tweet: tweet, err: err}
+			}
+		}()
+	}
+
+	go func() {
+		for i := range pending {
+			jobs <- &pending[i]
+		}
+
+		close(jobs)
+		wg.Wait()
+		close(outcomes)
+	}()
+
+	for outcome := range outcomes {
+		if outcome.err != nil {
+			result.Failed[outcome.tweet.ID] = outcome.err
+			notify(opts.Observer, &Event{Kind: EventTweetFailed, Tweet: outcome.tweet, Err: outcome.err})
+		} else {
+			result.Deleted++
+			notify(opts.Observer, &Event{Kind: EventTweetDeleted, Tweet: outcome.tweet})
 		}
 	}
 
-	return nil
+	if len(result.Failed) > 0 {
+		return result, fmt.Errorf("Failed to delete %d of %d tweets", len(result.Failed), len(pending))
+	}
+
+	return result, nil
 }
@@ -1,6 +1,7 @@
 package histweet
 
 import (
+	"fmt"
 	"net/http"
 	"testing"
 
@@ -11,7 +12,7 @@ import (
 type mockTwitterAccountService struct{}
 
 func (s *mockTwitterAccountService) VerifyCredentials(params *twitter.AccountVerifyParams) (*twitter.User, *http.Response, error) {
-	return nil, nil, nil
+	return &twitter.User{ID: 42, ScreenName: "potato", FollowersCount: 150}, nil, nil
 }
 
 type mockTwitterTimelineService struct{}
@@ -21,6 +22,8 @@ func (s *mockTwitterTimelineService) UserTimeline(params *twitter.UserTimelinePa
 
 	tweets[0].FavoriteCount = 10
 	tweets[1].Text = "potato"
+	tweets[2].ReplyCount = 4
+	tweets[2].QuoteCount = 1
 
 	return tweets, nil, nil
 }
@@ -28,6 +31,14 @@ func (s *mockTwitterTimelineService) UserTimeline(params *twitter.UserTimelinePa
 type mockTwitterStatusService struct{}
 
 func (s *mockTwitterStatusService) Destroy(id int64, params *twitter.StatusDestroyParams) (*twitter.Tweet, *http.Response, error) {
+	// Tweets with odd IDs have already been deleted
+	if id%2 == 1 {
+		resp := &http.Response{StatusCode: http.StatusNotFound}
+		err := twitter.APIError{Errors: []twitter.ErrorDetail{{Code: errorCodeNoStatus}}}
+
+		return nil, resp, err
+	}
+
 	return nil, nil, nil
 }
 
@@ -59,6 +70,7 @@ func TestTweetAPIs(t *testing.T) {
 	client := &mockTwitterClient{}
 
 	tweetRule, _ := Parse(`likes >= 3 || text ~ "potato"`)
+	engagementRule, _ := Parse(`replies > 3 && quotes == 1 && engagement == 4`)
 
 	// Test cases
 	var inputs = []struct {
@@ -67,6 +79,7 @@ func TestTweetAPIs(t *testing.T) {
 		matches int
 	}{
 		{"rule_tweet", &Rule{Tweet: tweetRule}, 2},
+		{"rule_engagement", &Rule{Tweet: engagementRule}, 1},
 
 		// The count rule will keep the 10 latest tweets
 		// Since we have 100 tweets total (above), 90 will be deleted
@@ -75,12 +88,155 @@ func TestTweetAPIs(t *testing.T) {
 
 	for _, input := range inputs {
 		t.Run(input.name, func(t *testing.T) {
-			tweets, _ := FetchTimelineTweets(input.rule, client)
+			tweets, _ := FetchTimelineTweets(input.rule, client, nil)
 			if len(tweets) != input.matches {
 				t.Errorf("Expected %d tweets to match the rule", input.matches)
 			}
 
-			DeleteTweets(tweets, client)
+			_, err := DeleteTweets(tweets, client, nil)
+			if err != nil {
+				t.Errorf("Failed to delete tweets: %s", err)
+			}
 		})
 	}
 }
+
+func TestFetchAccount(t *testing.T) {
+	client := &mockTwitterClient{}
+
+	account, err := FetchAccount(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if account.ID != 42 || account.ScreenName != "potato" || account.Followers != 150 {
+		t.Errorf("Unexpected account: %+v", account)
+	}
+
+	rule, _ := Parse("followers > 100 && likes >= 3")
+	opts := &FetchOptions{Context: &EvalContext{Account: account}}
+
+	tweets, err := FetchTimelineTweets(&Rule{Tweet: rule}, client, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(tweets) != 1 {
+		t.Errorf("Expected 1 tweet to match, got %d", len(tweets))
+	}
+}
+
+// Mock account service that fails with a server error before succeeding
+type flakyTwitterAccountService struct {
+	failures int
+}
+
+func (s *flakyTwitterAccountService) VerifyCredentials(params *twitter.AccountVerifyParams) (*twitter.User, *http.Response, error) {
+	if s.failures > 0 {
+		s.failures--
+		return nil, &http.Response{StatusCode: http.StatusServiceUnavailable}, fmt.Errorf("unavailable")
+	}
+
+	return (&mockTwitterAccountService{}).VerifyCredentials(params)
+}
+
+type flakyTwitterClient struct {
+	mockTwitterClient
+	account *flakyTwitterAccountService
+}
+
+func (t *flakyTwitterClient) accountService() twitterAccountService {
+	return t.account
+}
+
+func TestFetchAccountRetry(t *testing.T) {
+	client := &flakyTwitterClient{account: &flakyTwitterAccountService{failures: 2}}
+	r, sleeps := newTestRetrier()
+
+	account, err := fetchAccount(client, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if account.ID != 42 || len(*sleeps) != 2 {
+		t.Errorf("Unexpected account (%+v) or sleeps (%v)", account, *sleeps)
+	}
+
+	client.account.failures = defaultMaxRetries + 1
+
+	_, err = fetchAccount(client, r)
+	if err == nil {
+		t.Errorf("Expected an error once all retries failed")
+	}
+}
+
+func TestDeleteTweetsAlreadyDeleted(t *testing.T) {
+	client := &mockTwitterClient{}
+
+	// Already deleted tweets are treated as a success
+	tweets := []Tweet{{ID: 1}, {ID: 2}, {ID: 3}}
+
+	result, err := DeleteTweets(tweets, client, nil)
+	if err != nil {
+		t.Errorf("Failed to delete tweets: %s", err)
+	}
+
+	if result.Deleted != 3 {
+		t.Errorf("Deleted %d tweets, expected 3", result.Deleted)
+	}
+}
+
+// Mock Twitter status service that fails to delete tweets with IDs that are
+// a multiple of 10
+type failingTwitterStatusService struct{}
+
+func (s *failingTwitterStatusService) Destroy(id int64, params *twitter.StatusDestroyParams) (*twitter.Tweet, *http.Response, error) {
+	if id%10 == 0 {
+		resp := &http.Response{StatusCode: http.StatusForbidden}
+		err := twitter.APIError{Errors: []twitter.ErrorDetail{{Code: 63}}}
+
+		return nil, resp, err
+	}
+
+	return nil, nil, nil
+}
+
+type failingTwitterClient struct {
+	mockTwitterClient
+}
+
+func (t *failingTwitterClient) statusService() twitterStatusService {
+	return &failingTwitterStatusService{}
+}
+
+func TestDeleteTweetsConcurrent(t *testing.T) {
+	tweets := make([]Tweet, 100)
+	for i := range tweets {
+		tweets[i].ID = int64(i + 1)
+	}
+
+	for _, concurrency := range []int{0, 1, 8, 200} {
+		t.Run(fmt.Sprintf("concurrency_%d", concurrency), func(t *testing.T) {
+			client := &countingTwitterClient{status: &countingTwitterStatusService{}}
+
+			result, err := DeleteTweets(tweets, client, &DeleteOptions{Concurrency: concurrency})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if result.Deleted != len(tweets) || len(client.status.destroyed) != len(tweets) {
+				t.Errorf("Deleted %d tweets, expected %d", result.Deleted, len(tweets))
+			}
+		})
+	}
+
+	// Errors are collected for each failed tweet, without stopping the others
+	result, err := DeleteTweets(tweets, &failingTwitterClient{}, &DeleteOptions{Concurrency: 4})
+	if err == nil {
+		t.Errorf("Expected an error")
+	}
+
+	if result.Deleted != 90 || len(result.Failed) != 10 || result.Failed[50] == nil {
+		t.Errorf("Unexpected result: %d deleted, %d failed", result.Deleted, len(result.Failed))
+	}
+}
@@ -4,21 +4,35 @@ import (
 	"fmt"
 	"regexp"
 	"strconv"
+	"strings"
 	"time"
 )
 
-// Helper function to check for unbalanced parens in a given string
+// Helper function to check for unbalanced parens in a given string. Parens
+// inside string literals are ignored.
 func checkUnbalancedParens(input string) error {
 	var parenStack []int
 
-	for i, c := range input {
+	inString := false
+
+	for i := 0; i < len(input); i++ {
+		c := input[i]
 		l := len(parenStack)
 
-		if c == '(' {
+		if inString {
+			if c == '\\' {
+				// Skip over the escaped character
+				i++
+			} else if c == '"' {
+				inString = false
+			}
+		} else if c == '"' {
+			inString = true
+		} else if c == '(' {
 			parenStack = append(parenStack, i)
 		} else if c == ')' {
 			if l == 0 {
-				return fmt.Errorf(`Unbalanced ")" at pos %d`, i)
+				return newParenError(input, ")", tokenRparen, i)
 			}
 
 			parenStack = parenStack[:len(parenStack)-1]
@@ -27,50 +41,153 @@ func checkUnbalancedParens(input string) error {
 
 	if len(parenStack) > 0 {
 		l := len(parenStack)
-		return fmt.Errorf(`Unbalanced "(" at pos %d`, parenStack[l-1])
+		return newParenError(input, "(", tokenLparen, parenStack[l-1])
 	}
 
 	return nil
 }
 
-func convertAgeToTime(age string) (time.Time, error) {
-	var days int
-	var months int
-	var years int
+func newParenError(input string, val string, kind tokenKind, pos int) *ParserError {
+	token := &token{kind: kind, val: val, pos: pos, size: 1}
+	token.line, token.col = lineAndCol(input, pos)
 
-	agePat := regexp.MustCompile(`(\d+y)?(\d+m)?(\d+d)?`)
+	return newParserError("Unbalanced paren", token)
+}
 
-	matches := agePat.FindStringSubmatch(age)
-	if matches == nil {
-		return time.Time{}, fmt.Errorf("Invalid age string provided: %s", age)
+// Helper function that converts a position in the given string to a line and
+// column number. Both are 1-indexed.
+func lineAndCol(input string, pos int) (int, int) {
+	if pos > len(input) {
+		pos = len(input)
 	}
 
-	for _, match := range matches[1:] {
-		if match == "" {
+	line := strings.Count(input[:pos], "\n") + 1
+	col := pos - strings.LastIndex(input[:pos], "\n")
+
+	return line, col
+}
+
+// Layouts of the times accepted by "created", along with the precision of
+// each layout
+var timeLayouts = []struct {
+	layout    string
+	precision time.Duration
+}{
+	{timeLayout, 24 * time.Hour},
+	{"2006-01-02", 24 * time.Hour},
+	{"2006-01-02T15:04", time.Minute},
+	{"2006-01-02T15:04Z07:00", time.Minute},
+	{"2006-01-02T15:04:05", time.Second},
+	{"2006-01-02T15:04:05Z07:00", time.Second},
+}
+
+// Converts a date or datetime to the range of time it covers: [start, end).
+// A date covers the entire day, and a datetime covers its smallest unit
+// (e.g., the whole minute for "2020-05-10T14:00"). Times without a time zone
+// are interpreted in the given location.
+func parseTimeRange(val string, location *time.Location) (time.Time, time.Time, error) {
+	for _, layout := range timeLayouts {
+		start, err := time.ParseInLocation(layout.layout, val, location)
+		if err != nil {
 			continue
 		}
 
-		val, err := strconv.ParseInt(match[:len(match)-1], 10, 32)
+		switch {
+		case layout.precision == 24*time.Hour:
+			// Days are not always 24 hours long
+			return start, start.AddDate(0, 0, 1), nil
+		case strings.Contains(val, "."):
+			// Fractional seconds are as precise as they get
+			return start, start.Add(time.Nanosecond), nil
+		default:
+			return start, start.Add(layout.precision), nil
+		}
+	}
+
+	return time.Time{}, time.Time{}, fmt.Errorf("Invalid time provided: %s", val)
+}
+
+// Units that can be used in an age and their sizes, in the order in which
+// they are formatted. Note that "m" is a month, while "min" is a minute.
+var ageUnitSizes = []struct {
+	suffix   string
+	years    int
+	months   int
+	days     int
+	duration time.Duration
+}{
+	{suffix: "y", years: 1},
+	{suffix: "m", months: 1},
+	{suffix: "w", days: 7},
+	{suffix: "d", days: 1},
+	{suffix: "h", duration: time.Hour},
+	{suffix: "min", duration: time.Minute},
+	{suffix: "s", duration: time.Second},
+}
+
+// Matches a single component of an age, e.g., "3d"
+var ageComponentPattern = regexp.MustCompile(`^(\d+)(min|[ymwdhs])`)
+
+// Count of each unit (by suffix) in an age string, e.g., {"y": 1, "d": 3} for
+// "1y3d". Units may appear in any order, but at most once.
+type ageUnits map[string]int
+
+func parseAge(val string) (ageUnits, error) {
+	result := make(ageUnits)
+	rest := val
+
+	for rest != "" {
+		match := ageComponentPattern.FindStringSubmatch(rest)
+		if match == nil {
+			return nil, fmt.Errorf("Invalid age string provided: %s", val)
+		}
+
+		n, err := strconv.Atoi(match[1])
 		if err != nil {
-			return time.Time{}, err
+			return nil, err
 		}
 
-		// The last character of this match must be one of: d, m, or y
-		switch match[len(match)-1] {
-		case 'd':
-			days = int(val)
-		case 'm':
-			months = int(val)
-		case 'y':
-			years = int(val)
-		default:
-			return time.Time{}, fmt.Errorf("Invalid age string provided: must only contain \"d\", \"m\", or \"y\"")
+		unit := match[2]
+		if _, ok := result[unit]; ok {
+			return nil, fmt.Errorf("Invalid age string provided: \"%s\" appears more than once", unit)
 		}
+
+		result[unit] = n
+		rest = rest[len(match[0]):]
+	}
+
+	if len(result) == 0 {
+		return nil, fmt.Errorf("Invalid age string provided: %s", val)
+	}
+
+	return result, nil
+}
+
+// Resolves these units to the calendar units and duration they stand for
+func (units ageUnits) resolve() Age {
+	var result Age
+
+	for _, unit := range ageUnitSizes {
+		n := units[unit.suffix]
+
+		result.Years += n * unit.years
+		result.Months += n * unit.months
+		result.Days += n * unit.days
+		result.Duration += time.Duration(n) * unit.duration
 	}
 
-	// This is how you go back in time
-	now := time.Now().UTC()
-	target := now.AddDate(-years, -months, -days)
+	return result
+}
+
+// Formats these units from largest to smallest, e.g., "1y3d"
+func (units ageUnits) String() string {
+	var output strings.Builder
+
+	for _, unit := range ageUnitSizes {
+		if n, ok := units[unit.suffix]; ok {
+			fmt.Fprintf(&output, "%d%s", n, unit.suffix)
+		}
+	}
 
-	return target, nil
+	return output.String()
 }
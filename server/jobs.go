@@ -0,0 +1,622 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	histweet "github.com/aksiksi/histweet/lib"
+)
+
+const (
+	// Minimum interval between two runs of a daemon job, in seconds
+	minJobInterval = 30
+
+	// Maximum number of runs kept in the history of each job
+	maxJobRuns = 50
+)
+
+// Status of a job or of a single run
+const (
+	jobPending   = "pending"
+	jobScheduled = "scheduled"
+	jobPaused    = "paused"
+	jobRunning   = "running"
+	jobDone      = "done"
+	jobFailed    = "failed"
+)
+
+// Twitter API keys used by a job
+type jobCredentials struct {
+	ConsumerKey    string `json:"consumer_key"`
+	ConsumerSecret string `json:"consumer_secret"`
+	AccessToken    string `json:"access_token"`
+	AccessSecret   string `json:"access_secret"`
+}
+
+// Request body to create a job
+type jobRequest struct {
+	jobCredentials
+
+	Rule        string `json:"rule"`
+	IsDaemon    bool   `json:"is_daemon"`
+	Interval    int    `json:"interval"`
+	Concurrency int    `json:"concurrency"`
+
+	// Time zone for dates in the rule without one (default: UTC)
+	Timezone string `json:"timezone"`
+}
+
+// A single run of a job
+type jobRun struct {
+	Status     string     `json:"status"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	Fetched    int        `json:"fetched"`
+	Matched    int        `json:"matched"`
+	Deleted    int        `json:"deleted"`
+	Failed     int        `json:"failed"`
+	Error      string     `json:"error,omitempty"`
+}
+
+// Persisted configuration and run history of a job
+type jobConfig struct {
+	ID          string         `json:"id"`
+	Rule        string         `json:"rule"`
+	IsDaemon    bool           `json:"is_daemon"`
+	Interval    int            `json:"interval"`
+	Concurrency int            `json:"concurrency"`
+	Timezone    string         `json:"timezone,omitempty"`
+	Paused      bool           `json:"paused"`
+	CreatedAt   time.Time      `json:"created_at"`
+	Credentials jobCredentials `json:"credentials"`
+	Runs        []*jobRun      `json:"runs"`
+}
+
+// A job as returned by the API. Credentials are never returned.
+type jobView struct {
+	ID        string     `json:"id"`
+	Rule      string     `json:"rule"`
+	IsDaemon  bool       `json:"is_daemon"`
+	Interval  int        `json:"interval"`
+	Timezone  string     `json:"timezone,omitempty"`
+	Status    string     `json:"status"`
+	CreatedAt time.Time  `json:"created_at"`
+	NextRunAt *time.Time `json:"next_run_at,omitempty"`
+	LastRun   *jobRun    `json:"last_run,omitempty"`
+
+	// Set if the job's rule no longer parses, e.g. after a grammar change
+	Error string `json:"error,omitempty"`
+}
+
+// A job that deletes all tweets matching a rule, either once or repeatedly
+// at a fixed interval (i.e., a daemon job)
+type job struct {
+	config jobConfig
+	rule   *histweet.Rule
+
+	// Error from parsing the stored rule. A job with an invalid rule is kept
+	// paused, but is still persisted so that it can be inspected or deleted.
+	ruleErr error
+
+	// Run in progress, if any
+	current *jobRun
+
+	// Closed to stop the scheduler of this job
+	stop chan struct{}
+
+	// Held for the duration of a run, so that runs never overlap (e.g., if
+	// the job is paused and resumed during a run)
+	runMu sync.Mutex
+
+	mu sync.Mutex
+}
+
+// OnEvent implements histweet.Observer
+func (job *job) OnEvent(event *histweet.Event) {
+	job.mu.Lock()
+	defer job.mu.Unlock()
+
+	run := job.current
+	if run == nil {
+		return
+	}
+
+	switch event.Kind {
+	case histweet.EventPageFetched:
+		run.Fetched += event.Count
+	case histweet.EventTweetMatched:
+		run.Matched++
+	case histweet.EventTweetDeleted:
+		run.Deleted++
+	case histweet.EventTweetFailed:
+		run.Failed++
+	}
+}
+
+// Returns the time of the next run, or nil if the job will not run again.
+// Daemon jobs run at a fixed interval from the start of the previous run.
+// Must be called with the lock held.
+func (job *job) nextRunAt() *time.Time {
+	if job.config.Paused {
+		return nil
+	}
+
+	last := job.current
+	if last == nil && len(job.config.Runs) > 0 {
+		last = job.config.Runs[len(job.config.Runs)-1]
+	}
+
+	if last == nil {
+		next := job.config.CreatedAt
+		return &next
+	}
+
+	if !job.config.IsDaemon {
+		return nil
+	}
+
+	next := last.StartedAt.Add(time.Duration(job.config.Interval) * time.Second)
+
+	return &next
+}
+
+// Returns the API representation of this job
+func (job *job) view() *jobView {
+	job.mu.Lock()
+	defer job.mu.Unlock()
+
+	view := &jobView{
+		ID:        job.config.ID,
+		Rule:      job.config.Rule,
+		IsDaemon:  job.config.IsDaemon,
+		Interval:  job.config.Interval,
+		Timezone:  job.config.Timezone,
+		CreatedAt: job.config.CreatedAt,
+		NextRunAt: job.nextRunAt(),
+	}
+
+	if job.ruleErr != nil {
+		view.Error = fmt.Sprintf("Invalid rule: %s", job.ruleErr)
+	}
+
+	if job.current != nil {
+		run := *job.current
+		view.LastRun = &run
+	} else if l := len(job.config.Runs); l > 0 {
+		run := *job.config.Runs[l-1]
+		view.LastRun = &run
+	}
+
+	switch {
+	case job.current != nil:
+		view.Status = jobRunning
+	case job.config.Paused:
+		view.Status = jobPaused
+	case view.NextRunAt == nil:
+		view.Status = view.LastRun.Status
+	case view.LastRun == nil:
+		view.Status = jobPending
+	default:
+		view.Status = jobScheduled
+	}
+
+	return view
+}
+
+// Returns a copy of the persisted job configuration
+func (job *job) snapshot() *jobConfig {
+	job.mu.Lock()
+	defer job.mu.Unlock()
+
+	config := job.config
+	config.Runs = append([]*jobRun{}, job.config.Runs...)
+
+	return &config
+}
+
+// Fetches all tweets that match the job's rule from the timeline and deletes
+// them
+func (job *job) run() {
+	job.runMu.Lock()
+	defer job.runMu.Unlock()
+
+	job.mu.Lock()
+	job.current = &jobRun{
+		Status:    jobRunning,
+		StartedAt: time.Now().UTC(),
+	}
+	creds := job.config.Credentials
+	concurrency := job.config.Concurrency
+	timezone := job.config.Timezone
+	job.mu.Unlock()
+
+	err := func() error {
+		client, err := histweet.NewTwitterClient(creds.ConsumerKey,
+			creds.ConsumerSecret,
+			creds.AccessToken,
+			creds.AccessSecret,
+			true)
+		if err != nil {
+			return err
+		}
+
+		location, err := time.LoadLocation(timezone)
+		if err != nil {
+			return err
+		}
+
+		ctx := &histweet.EvalContext{Location: location}
+
+		if job.rule.NeedsAccount() {
+			ctx.Account, err = histweet.FetchAccount(client)
+			if err != nil {
+				return err
+			}
+		}
+
+		fetchOpts := &histweet.FetchOptions{
+			Observer: job,
+			Context:  ctx,
+		}
+
+		tweets, err := histweet.FetchTimelineTweets(job.rule, client, fetchOpts)
+		if err != nil {
+			return err
+		}
+
+		opts := &histweet.DeleteOptions{
+			Concurrency: concurrency,
+			Observer:    job,
+		}
+
+		_, err = histweet.DeleteTweets(tweets, client, opts)
+
+		return err
+	}()
+
+	job.mu.Lock()
+	defer job.mu.Unlock()
+
+	run := job.current
+	job.current = nil
+
+	now := time.Now().UTC()
+	run.FinishedAt = &now
+
+	if err != nil {
+		run.Status = jobFailed
+		run.Error = err.Error()
+	} else {
+		run.Status = jobDone
+	}
+
+	job.config.Runs = append(job.config.Runs, run)
+
+	if l := len(job.config.Runs); l > maxJobRuns {
+		job.config.Runs = job.config.Runs[l-maxJobRuns:]
+	}
+}
+
+// Keeps track of all jobs, runs them on schedule, and persists them to the
+// store
+type jobManager struct {
+	jobs  map[string]*job
+	store *jobStore
+	mu    sync.Mutex
+}
+
+func newJobManager(store *jobStore) *jobManager {
+	return &jobManager{
+		jobs:  make(map[string]*job),
+		store: store,
+	}
+}
+
+// Loads all jobs from the store and schedules all active jobs
+func (m *jobManager) load() error {
+	configs, err := m.store.load()
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, config := range configs {
+		job := &job{config: *config}
+
+		parsed, err := histweet.NewParser(config.Rule).Parse()
+		if err != nil {
+			log.Printf("Pausing job %s with invalid rule: %s", config.ID, err)
+			job.config.Paused = true
+			job.ruleErr = err
+		} else {
+			job.rule = &histweet.Rule{
+				Tweet: parsed,
+				Input: config.Rule,
+			}
+		}
+
+		m.jobs[job.config.ID] = job
+
+		if !job.config.Paused {
+			m.schedule(job)
+		}
+	}
+
+	log.Printf("Loaded %d jobs from %s", len(m.jobs), m.store.path)
+
+	return nil
+}
+
+// Writes all jobs to the store
+func (m *jobManager) save() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	configs := make([]*jobConfig, 0, len(m.jobs))
+
+	for _, job := range m.jobs {
+		configs = append(configs, job.snapshot())
+	}
+
+	err := m.store.save(configs)
+	if err != nil {
+		log.Printf("Failed to save jobs: %s", err)
+	}
+}
+
+// Starts the scheduler of the given job, which runs the job whenever it is
+// due until the job is paused or deleted.
+// Must be called with the manager lock held.
+func (m *jobManager) schedule(job *job) {
+	stop := make(chan struct{})
+	job.stop = stop
+
+	go func() {
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+
+			job.mu.Lock()
+			next := job.nextRunAt()
+			job.mu.Unlock()
+
+			if next == nil {
+				return
+			}
+
+			timer := time.NewTimer(time.Until(*next))
+
+			select {
+			case <-timer.C:
+				job.run()
+				m.save()
+			case <-stop:
+				timer.Stop()
+				return
+			}
+		}
+	}()
+}
+
+// Stops the scheduler of the given job. A run in progress is not interrupted.
+// Must be called with the manager lock held.
+func (m *jobManager) unschedule(job *job) {
+	if job.stop != nil {
+		close(job.stop)
+		job.stop = nil
+	}
+}
+
+// Generates a random job ID
+func newJobID() (string, error) {
+	buf := make([]byte, 8)
+
+	_, err := rand.Read(buf)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(buf), nil
+}
+
+// Handles requests to /jobs
+func (m *jobManager) jobsHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		m.listHandler(w, r)
+	case http.MethodPost:
+		m.createHandler(w, r)
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// Handles requests to /jobs/{id} and its sub-resources
+func (m *jobManager) jobHandler(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/jobs/"), "/")
+	if len(parts) > 2 {
+		writeError(w, http.StatusNotFound, "Not found")
+		return
+	}
+
+	m.mu.Lock()
+	job, ok := m.jobs[parts[0]]
+	m.mu.Unlock()
+
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("No job with ID \"%s\"", parts[0]))
+		return
+	}
+
+	action := ""
+	if len(parts) == 2 {
+		action = parts[1]
+	}
+
+	switch {
+	case action == "" && r.Method == http.MethodGet:
+		writeJSON(w, http.StatusOK, job.view())
+	case action == "" && r.Method == http.MethodDelete:
+		m.deleteJob(w, job)
+	case action == "runs" && r.Method == http.MethodGet:
+		m.runsHandler(w, job)
+	case action == "pause" && r.Method == http.MethodPost:
+		m.setPaused(w, job, true)
+	case action == "resume" && r.Method == http.MethodPost:
+		m.setPaused(w, job, false)
+	case action == "" || action == "runs" || action == "pause" || action == "resume":
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	default:
+		writeError(w, http.StatusNotFound, "Not found")
+	}
+}
+
+// Handles GET /jobs
+func (m *jobManager) listHandler(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+
+	jobs := make([]*jobView, 0, len(m.jobs))
+
+	for _, job := range m.jobs {
+		jobs = append(jobs, job.view())
+	}
+
+	m.mu.Unlock()
+
+	resp := struct {
+		Jobs []*jobView `json:"jobs"`
+	}{
+		Jobs: jobs,
+	}
+
+	writeJSON(w, http.StatusOK, &resp)
+}
+
+// Handles POST /jobs
+func (m *jobManager) createHandler(w http.ResponseWriter, r *http.Request) {
+	var req jobRequest
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid JSON request body: %s", err))
+		return
+	}
+
+	if req.ConsumerKey == "" || req.ConsumerSecret == "" ||
+		req.AccessToken == "" || req.AccessSecret == "" {
+		writeError(w, http.StatusBadRequest, "All Twitter API keys are required")
+		return
+	}
+
+	if req.IsDaemon && req.Interval < minJobInterval {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("The minimum daemon interval is %d", minJobInterval))
+		return
+	}
+
+	parsed, ok := parseRule(w, req.Rule)
+	if !ok {
+		return
+	}
+
+	if _, err := time.LoadLocation(req.Timezone); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid time zone: %s", req.Timezone))
+		return
+	}
+
+	id, err := newJobID()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to create job: %s", err))
+		return
+	}
+
+	job := &job{
+		config: jobConfig{
+			ID:          id,
+			Rule:        req.Rule,
+			IsDaemon:    req.IsDaemon,
+			Interval:    req.Interval,
+			Concurrency: req.Concurrency,
+			Timezone:    req.Timezone,
+			CreatedAt:   time.Now().UTC(),
+			Credentials: req.jobCredentials,
+		},
+		rule: &histweet.Rule{
+			Tweet: parsed,
+			Input: req.Rule,
+		},
+	}
+
+	m.mu.Lock()
+	m.jobs[id] = job
+	m.schedule(job)
+	m.mu.Unlock()
+
+	m.save()
+
+	w.Header().Set("Location", "/jobs/"+id)
+	writeJSON(w, http.StatusCreated, job.view())
+}
+
+// Handles DELETE /jobs/{id}
+func (m *jobManager) deleteJob(w http.ResponseWriter, job *job) {
+	m.mu.Lock()
+	m.unschedule(job)
+	delete(m.jobs, job.config.ID)
+	m.mu.Unlock()
+
+	m.save()
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Handles POST /jobs/{id}/pause and POST /jobs/{id}/resume
+func (m *jobManager) setPaused(w http.ResponseWriter, job *job, paused bool) {
+	if !paused && job.ruleErr != nil {
+		writeError(w, http.StatusConflict, fmt.Sprintf("Cannot resume a job with an invalid rule: %s", job.ruleErr))
+		return
+	}
+
+	m.mu.Lock()
+
+	job.mu.Lock()
+	job.config.Paused = paused
+	job.mu.Unlock()
+
+	if paused {
+		m.unschedule(job)
+	} else if job.stop == nil {
+		m.schedule(job)
+	}
+
+	m.mu.Unlock()
+
+	m.save()
+
+	writeJSON(w, http.StatusOK, job.view())
+}
+
+// Handles GET /jobs/{id}/runs
+func (m *jobManager) runsHandler(w http.ResponseWriter, job *job) {
+	config := job.snapshot()
+
+	resp := struct {
+		Runs []*jobRun `json:"runs"`
+	}{
+		Runs: config.Runs,
+	}
+
+	writeJSON(w, http.StatusOK, &resp)
+}
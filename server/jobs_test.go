@@ -0,0 +1,282 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	histweet "github.com/aksiksi/histweet/lib"
+)
+
+// Creates a job manager backed by a store in a temporary directory
+func newTestJobManager(t *testing.T) (*jobManager, func()) {
+	dir, err := ioutil.TempDir("", "histweet")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := newJobManager(newJobStore(filepath.Join(dir, "jobs.json")))
+
+	cleanup := func() {
+		m.mu.Lock()
+		for _, job := range m.jobs {
+			m.unschedule(job)
+		}
+		m.mu.Unlock()
+
+		os.RemoveAll(dir)
+	}
+
+	return m, cleanup
+}
+
+// Creates a job for the given rule and adds it to the manager
+func addTestJob(t *testing.T, m *jobManager, config jobConfig) *job {
+	parsed, err := histweet.Parse(config.Rule)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	job := &job{
+		config: config,
+		rule:   &histweet.Rule{Tweet: parsed, Input: config.Rule},
+	}
+
+	m.mu.Lock()
+	m.jobs[config.ID] = job
+	if !config.Paused {
+		m.schedule(job)
+	}
+	m.mu.Unlock()
+
+	return job
+}
+
+// Sends a request to the handler of a single job and decodes the response
+func doJobRequest(t *testing.T, m *jobManager, method, path string) (int, *jobView) {
+	w := httptest.NewRecorder()
+	m.jobHandler(w, httptest.NewRequest(method, path, nil))
+
+	if w.Code != http.StatusOK {
+		return w.Code, nil
+	}
+
+	var view jobView
+
+	err := json.Unmarshal(w.Body.Bytes(), &view)
+	if err != nil {
+		t.Fatalf("Invalid response: %s", w.Body)
+	}
+
+	return w.Code, &view
+}
+
+func TestJobStatus(t *testing.T) {
+	createdAt := time.Date(2020, 7, 1, 12, 0, 0, 0, time.UTC)
+	startedAt := createdAt.Add(time.Minute)
+
+	done := &jobRun{Status: jobDone, StartedAt: startedAt}
+	failed := &jobRun{Status: jobFailed, StartedAt: startedAt, Error: "oops"}
+	running := &jobRun{Status: jobRunning, StartedAt: startedAt}
+
+	var inputs = []struct {
+		name     string
+		config   jobConfig
+		current  *jobRun
+		status   string
+		expected *time.Time
+	}{
+		{"new", jobConfig{}, nil, jobPending, &createdAt},
+		{"new daemon", jobConfig{IsDaemon: true, Interval: 60}, nil, jobPending, &createdAt},
+		{"running", jobConfig{}, running, jobRunning, nil},
+		{"done", jobConfig{Runs: []*jobRun{done}}, nil, jobDone, nil},
+		{"failed", jobConfig{Runs: []*jobRun{failed}}, nil, jobFailed, nil},
+		{"daemon", jobConfig{IsDaemon: true, Interval: 60, Runs: []*jobRun{failed}}, nil, jobScheduled, timePtr(startedAt.Add(time.Minute))},
+		{"running daemon", jobConfig{IsDaemon: true, Interval: 60, Runs: []*jobRun{done}}, &jobRun{Status: jobRunning, StartedAt: startedAt.Add(time.Hour)}, jobRunning, timePtr(startedAt.Add(61 * time.Minute))},
+		{"paused", jobConfig{IsDaemon: true, Interval: 60, Paused: true, Runs: []*jobRun{done}}, nil, jobPaused, nil},
+		{"paused while running", jobConfig{IsDaemon: true, Interval: 60, Paused: true}, running, jobRunning, nil},
+	}
+
+	for _, input := range inputs {
+		t.Run(input.name, func(t *testing.T) {
+			job := &job{config: input.config, current: input.current}
+			job.config.CreatedAt = createdAt
+
+			view := job.view()
+
+			if view.Status != input.status {
+				t.Errorf("Expected status %s, got %s", input.status, view.Status)
+			}
+
+			if !reflect.DeepEqual(view.NextRunAt, input.expected) {
+				t.Errorf("Expected next run at %v, got %v", input.expected, view.NextRunAt)
+			}
+		})
+	}
+}
+
+func timePtr(t time.Time) *time.Time {
+	return &t
+}
+
+func TestJobPauseDuringRun(t *testing.T) {
+	m, cleanup := newTestJobManager(t)
+	defer cleanup()
+
+	// The last run was just now, so the scheduler will not start another one
+	// during the test
+	now := time.Now().UTC()
+	job := addTestJob(t, m, jobConfig{
+		ID:        "abc",
+		Rule:      "likes < 3",
+		IsDaemon:  true,
+		Interval:  3600,
+		CreatedAt: now,
+		Runs:      []*jobRun{{Status: jobDone, StartedAt: now}},
+	})
+
+	// Simulate a run in progress
+	job.mu.Lock()
+	job.current = &jobRun{Status: jobRunning, StartedAt: now}
+	job.mu.Unlock()
+
+	code, view := doJobRequest(t, m, http.MethodPost, "/jobs/abc/pause")
+	if code != http.StatusOK {
+		t.Fatalf("Failed to pause job: %d", code)
+	}
+
+	// The run in progress is not interrupted
+	if view.Status != jobRunning || view.NextRunAt != nil {
+		t.Errorf("Unexpected job after pausing: %+v", view)
+	}
+
+	if job.stop != nil {
+		t.Errorf("Expected the scheduler to be stopped")
+	}
+
+	// Once the run finishes, the job stays paused
+	job.mu.Lock()
+	job.config.Runs = append(job.config.Runs, job.current)
+	job.current = nil
+	job.mu.Unlock()
+
+	if view := job.view(); view.Status != jobPaused {
+		t.Errorf("Expected the job to be paused, got: %s", view.Status)
+	}
+
+	_, view = doJobRequest(t, m, http.MethodPost, "/jobs/abc/resume")
+	if view.Status != jobScheduled || view.NextRunAt == nil || !view.NextRunAt.Equal(now.Add(time.Hour)) {
+		t.Errorf("Unexpected job after resuming: %+v", view)
+	}
+
+	// Resuming twice must not start a second scheduler
+	stop := job.stop
+	if stop == nil {
+		t.Fatalf("Expected the scheduler to be started")
+	}
+
+	doJobRequest(t, m, http.MethodPost, "/jobs/abc/resume")
+
+	if job.stop != stop {
+		t.Errorf("Expected the scheduler to be reused")
+	}
+
+	// Pausing and resuming are persisted
+	doJobRequest(t, m, http.MethodPost, "/jobs/abc/pause")
+
+	configs, err := m.store.load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(configs) != 1 || !configs[0].Paused || len(configs[0].Runs) != 2 {
+		t.Errorf("Unexpected stored jobs: %+v", configs)
+	}
+}
+
+func TestJobStoreRoundTrip(t *testing.T) {
+	m, cleanup := newTestJobManager(t)
+	defer cleanup()
+
+	now := time.Now().UTC().Truncate(time.Second)
+	finishedAt := now.Add(time.Minute)
+
+	configs := []*jobConfig{
+		{
+			ID:          "valid",
+			Rule:        "likes < 3 && age > 1y",
+			IsDaemon:    true,
+			Interval:    3600,
+			Concurrency: 4,
+			Timezone:    "America/New_York",
+			CreatedAt:   now,
+			Credentials: jobCredentials{ConsumerKey: "a", ConsumerSecret: "b", AccessToken: "c", AccessSecret: "d"},
+			Runs:        []*jobRun{{Status: jobDone, StartedAt: now, FinishedAt: &finishedAt, Fetched: 10, Matched: 2, Deleted: 2}},
+		},
+		{
+			// "mon" is a weekday, so this rule no longer parses
+			ID:          "invalid",
+			Rule:        "mon > 3",
+			IsDaemon:    true,
+			Interval:    3600,
+			CreatedAt:   now,
+			Credentials: jobCredentials{ConsumerKey: "e", ConsumerSecret: "f", AccessToken: "g", AccessSecret: "h"},
+			Runs:        []*jobRun{{Status: jobFailed, StartedAt: now, FinishedAt: &finishedAt, Error: "oops"}},
+		},
+	}
+
+	err := m.store.save(configs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = m.load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(m.jobs) != 2 {
+		t.Fatalf("Expected 2 jobs to be loaded, got %d", len(m.jobs))
+	}
+
+	if view := m.jobs["valid"].view(); view.Status != jobScheduled || view.Error != "" {
+		t.Errorf("Unexpected valid job: %+v", view)
+	}
+
+	if view := m.jobs["invalid"].view(); view.Status != jobPaused || view.Error == "" {
+		t.Errorf("Unexpected invalid job: %+v", view)
+	}
+
+	// A job with an invalid rule cannot be resumed
+	code, _ := doJobRequest(t, m, http.MethodPost, "/jobs/invalid/resume")
+	if code != http.StatusConflict {
+		t.Errorf("Expected resuming an invalid job to fail, got: %d", code)
+	}
+
+	m.save()
+
+	saved, err := m.store.load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	byID := make(map[string]*jobConfig)
+	for _, config := range saved {
+		byID[config.ID] = config
+	}
+
+	// Jobs are saved unchanged, except that the invalid job is now paused
+	configs[1].Paused = true
+
+	for _, config := range configs {
+		if !reflect.DeepEqual(byID[config.ID], config) {
+			t.Errorf("Job changed after a round trip: %+v != %+v", byID[config.ID], config)
+		}
+	}
+}
@@ -2,68 +2,65 @@ package main
 
 import (
 	"encoding/json"
-	"fmt"
+	"flag"
 	"log"
 	"net/http"
-
-	histweet "github.com/aksiksi/histweet/lib"
 )
 
-func ruleHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		w.WriteHeader(http.StatusMethodNotAllowed)
-		return
-	}
-
-	req := struct {
-		Rule     string `json:"rule"`
-		IsDaemon bool   `json:"is_daemon"`
-		Interval int    `json:"interval"`
-	}{}
+// Response body for all failed requests
+type errorResponse struct {
+	Success bool   `json:"success"`
+	Msg     string `json:"msg"`
+}
 
-	resp := struct {
-		Success bool   `json:"success"`
-		Msg     string `json:"msg"`
-	}{
-		Success: true,
+// Writes the given value as a JSON response body
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	buf, err := json.Marshal(v)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
 	}
 
-	decoder := json.NewDecoder(r.Body)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(buf)
+}
 
-	err := decoder.Decode(&req)
-	if err != nil {
-		resp.Success = false
-		resp.Msg = fmt.Sprintf("Invalid JSON request body: %s", err)
-		resp, _ := json.Marshal(&resp)
+// Writes an error response with the given message
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, &errorResponse{Success: false, Msg: msg})
+}
 
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write(resp)
+// Wraps a handler to only allow the given HTTP method
+func allowMethod(method string, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != method {
+			w.Header().Set("Allow", method)
+			writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+			return
+		}
 
-		return
+		handler(w, r)
 	}
+}
 
-	// Parse the Rule
-	parser := histweet.NewParser(req.Rule)
-	rule, err := parser.Parse()
-	if err != nil {
-		resp.Success = false
-		resp.Msg = fmt.Sprintf("Invalid rule string provided: %s", err)
-		resp, _ := json.Marshal(&resp)
+func main() {
+	addr := flag.String("addr", ":8080", "Address to listen on")
+	storePath := flag.String("store", "histweet-jobs.json", "Path to the file in which jobs are stored")
+	flag.Parse()
 
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write(resp)
+	jobs := newJobManager(newJobStore(*storePath))
 
-		return
+	err := jobs.load()
+	if err != nil {
+		log.Fatalf("Failed to load jobs from %s: %s", *storePath, err)
 	}
 
-	fmt.Println(rule)
-
-	bytes := []byte(rule.ToString())
-	w.Write(bytes)
-}
-
-func main() {
-	http.HandleFunc("/rule", ruleHandler)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/rules/validate", allowMethod(http.MethodPost, validateHandler))
+	mux.HandleFunc("/preview", allowMethod(http.MethodPost, previewHandler))
+	mux.HandleFunc("/jobs", jobs.jobsHandler)
+	mux.HandleFunc("/jobs/", jobs.jobHandler)
 
-	log.Fatal(http.ListenAndServe(":8080", nil))
+	log.Fatal(http.ListenAndServe(*addr, mux))
 }
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	histweet "github.com/aksiksi/histweet/lib"
+)
+
+const (
+	// Maximum size of an uploaded archive
+	maxArchiveSize = 512 << 20
+
+	// Maximum size of an uploaded archive to keep in memory
+	maxArchiveMemory = 32 << 20
+)
+
+// Request body for rule validation
+type ruleRequest struct {
+	Rule string `json:"rule"`
+}
+
+// Position and details of an invalid rule
+type ruleError struct {
+	Msg   string `json:"msg"`
+	Pos   int    `json:"pos"`
+	Line  int    `json:"line"`
+	Col   int    `json:"col"`
+	Token string `json:"token"`
+	Kind  string `json:"kind"`
+}
+
+// Response body for an invalid rule
+type invalidRuleResponse struct {
+	Success bool       `json:"success"`
+	Msg     string     `json:"msg"`
+	Error   *ruleError `json:"error,omitempty"`
+}
+
+// Parses the given rule, and writes an error response if the rule is invalid
+func parseRule(w http.ResponseWriter, input string) (*histweet.ParsedRule, bool) {
+	rule, err := histweet.NewParser(input).Parse()
+	if err == nil {
+		return rule, true
+	}
+
+	resp := &invalidRuleResponse{
+		Success: false,
+		Msg:     fmt.Sprintf("Invalid rule string provided: %s", err),
+	}
+
+	var parserErr *histweet.ParserError
+	if errors.As(err, &parserErr) {
+		resp.Error = &ruleError{
+			Msg:   parserErr.Message(),
+			Pos:   parserErr.Pos(),
+			Line:  parserErr.Line(),
+			Col:   parserErr.Col(),
+			Token: parserErr.Token(),
+			Kind:  parserErr.TokenKind(),
+		}
+	}
+
+	writeJSON(w, http.StatusUnprocessableEntity, resp)
+
+	return nil, false
+}
+
+// Handles POST /rules/validate
+func validateHandler(w http.ResponseWriter, r *http.Request) {
+	var req ruleRequest
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid JSON request body: %s", err))
+		return
+	}
+
+	parsed, ok := parseRule(w, req.Rule)
+	if !ok {
+		return
+	}
+
+	resp := struct {
+		Success bool                 `json:"success"`
+		Rule    string               `json:"rule"`
+		AST     *histweet.ParsedRule `json:"ast"`
+	}{
+		Success: true,
+		Rule:    req.Rule,
+		AST:     parsed,
+	}
+
+	writeJSON(w, http.StatusOK, &resp)
+}
+
+// Saves an uploaded archive to a temporary file, keeping the extension of the
+// uploaded file so that ZIP archives are detected
+func saveArchive(r io.Reader, name string) (string, error) {
+	ext := ".js"
+	if strings.EqualFold(filepath.Ext(name), ".zip") {
+		ext = ".zip"
+	}
+
+	f, err := ioutil.TempFile("", "histweet-archive-*"+ext)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = io.Copy(f, r)
+	if err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return "", err
+	}
+
+	err = f.Close()
+	if err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+
+	return f.Name(), nil
+}
+
+// Builds the context to evaluate a rule in from the given time zone and time,
+// and writes an error response if either is invalid
+func parseEvalContext(w http.ResponseWriter, timezone string, now string) (*histweet.EvalContext, bool) {
+	location, err := time.LoadLocation(timezone)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid time zone: %s", timezone))
+		return nil, false
+	}
+
+	ctx := &histweet.EvalContext{Location: location}
+
+	if now != "" {
+		ctx.Now, err = time.Parse(time.RFC3339, now)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid time: %s", now))
+			return nil, false
+		}
+	}
+
+	return ctx, true
+}
+
+// A single tweet in a preview
+type previewTweet struct {
+	ID          int64     `json:"id"`
+	CreatedAt   time.Time `json:"created_at"`
+	Text        string    `json:"text"`
+	NumLikes    int       `json:"likes"`
+	NumRetweets int       `json:"retweets"`
+	NumReplies  int       `json:"replies"`
+	NumQuotes   int       `json:"quotes"`
+	IsRetweet   bool      `json:"is_retweet"`
+	IsReply     bool      `json:"is_reply"`
+	IsQuote     bool      `json:"is_quote"`
+	HasMedia    bool      `json:"has_media"`
+	HasLink     bool      `json:"has_link"`
+}
+
+// Handles POST /preview
+//
+// Expects a multipart form with a "rule" field and an "archive" file
+// (tweet.js or the archive ZIP), and returns all matching tweets. The
+// optional "timezone" field is used for dates in the rule without one, and
+// the optional "now" field (RFC 3339) evaluates the rule as of that time.
+func previewHandler(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxArchiveSize)
+
+	err := r.ParseMultipartForm(maxArchiveMemory)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid multipart request body: %s", err))
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	parsed, ok := parseRule(w, r.FormValue("rule"))
+	if !ok {
+		return
+	}
+
+	ctx, ok := parseEvalContext(w, r.FormValue("timezone"), r.FormValue("now"))
+	if !ok {
+		return
+	}
+
+	upload, header, err := r.FormFile("archive")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid archive: %s", err))
+		return
+	}
+	defer upload.Close()
+
+	path, err := saveArchive(upload, header.Filename)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to save archive: %s", err))
+		return
+	}
+	defer os.Remove(path)
+
+	rule := &histweet.Rule{
+		Tweet: parsed,
+		Input: r.FormValue("rule"),
+	}
+
+	tweets, err := histweet.FetchArchiveTweets(rule, &histweet.FetchOptions{Context: ctx}, path)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	previews := make([]previewTweet, 0, len(tweets))
+
+	for _, tweet := range tweets {
+		previews = append(previews, previewTweet{
+			ID:          tweet.ID,
+			CreatedAt:   tweet.CreatedAt,
+			Text:        tweet.Text,
+			NumLikes:    tweet.NumLikes,
+			NumRetweets: tweet.NumRetweets,
+			NumReplies:  tweet.NumReplies,
+			NumQuotes:   tweet.NumQuotes,
+			IsRetweet:   tweet.IsRetweet,
+			IsReply:     tweet.IsReply,
+			IsQuote:     tweet.IsQuote,
+			HasMedia:    tweet.HasMedia,
+			HasLink:     tweet.HasLink,
+		})
+	}
+
+	resp := struct {
+		Success bool           `json:"success"`
+		Count   int            `json:"count"`
+		Tweets  []previewTweet `json:"tweets"`
+	}{
+		Success: true,
+		Count:   len(previews),
+		Tweets:  previews,
+	}
+
+	writeJSON(w, http.StatusOK, &resp)
+}
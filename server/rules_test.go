@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	histweet "github.com/aksiksi/histweet/lib"
+)
+
+func TestValidateHandler(t *testing.T) {
+	var inputs = []struct {
+		body   string
+		status int
+	}{
+		{`{"rule": "likes > 3 && age > 1y"}`, http.StatusOK},
+		{`{"rule": "text word \"@bob\"i || weekday in [sat, sun]"}`, http.StatusOK},
+		{`{"rule": "likes >"}`, http.StatusUnprocessableEntity},
+		{`{"rule": ""}`, http.StatusUnprocessableEntity},
+		{`{"rule": "text ~ \"(\""}`, http.StatusUnprocessableEntity},
+		{`{"rule": 3}`, http.StatusBadRequest},
+		{`{"rule": "likes > 3"`, http.StatusBadRequest},
+		{`likes > 3`, http.StatusBadRequest},
+	}
+
+	for _, input := range inputs {
+		t.Run(input.body, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			validateHandler(w, httptest.NewRequest(http.MethodPost, "/rules/validate", strings.NewReader(input.body)))
+
+			if w.Code != input.status {
+				t.Fatalf("Expected status %d, got %d: %s", input.status, w.Code, w.Body)
+			}
+
+			if w.Code != http.StatusOK {
+				return
+			}
+
+			// The returned AST must describe the same rule
+			var resp struct {
+				Rule string              `json:"rule"`
+				AST  histweet.ParsedRule `json:"ast"`
+			}
+
+			err := json.Unmarshal(w.Body.Bytes(), &resp)
+			if err != nil {
+				t.Fatalf("Invalid response: %s", err)
+			}
+
+			expected, _ := histweet.Parse(resp.Rule)
+			if histweet.Format(&resp.AST) != histweet.Format(expected) {
+				t.Errorf("Unexpected AST: %s", w.Body)
+			}
+		})
+	}
+
+	// Only POST is allowed
+	w := httptest.NewRecorder()
+	allowMethod(http.MethodPost, validateHandler)(w, httptest.NewRequest(http.MethodGet, "/rules/validate", nil))
+
+	if w.Code != http.StatusMethodNotAllowed || w.Header().Get("Allow") != http.MethodPost {
+		t.Errorf("Expected GET to be rejected, got: %d", w.Code)
+	}
+}
+
+func TestValidateHandlerErrorPosition(t *testing.T) {
+	var inputs = []struct {
+		rule  string
+		line  int
+		col   int
+		token string
+	}{
+		{"likes > 3 &&\n  retweets >= text", 2, 15, "text"},
+		{`likes > 3 && text ~ "a(b"`, 1, 21, `"a(b"`},
+		{"hour in [0,  24]", 1, 14, "24"},
+	}
+
+	for _, input := range inputs {
+		t.Run(input.rule, func(t *testing.T) {
+			body, _ := json.Marshal(&ruleRequest{Rule: input.rule})
+
+			w := httptest.NewRecorder()
+			validateHandler(w, httptest.NewRequest(http.MethodPost, "/rules/validate", bytes.NewReader(body)))
+
+			if w.Code != http.StatusUnprocessableEntity {
+				t.Fatalf("Expected status 422, got %d: %s", w.Code, w.Body)
+			}
+
+			var resp invalidRuleResponse
+
+			err := json.Unmarshal(w.Body.Bytes(), &resp)
+			if err != nil {
+				t.Fatalf("Invalid response: %s", err)
+			}
+
+			if resp.Success || resp.Error == nil {
+				t.Fatalf("Expected error details: %s", w.Body)
+			}
+
+			if resp.Error.Line != input.line || resp.Error.Col != input.col || resp.Error.Token != input.token {
+				t.Errorf("Unexpected error position: %s", w.Body)
+			}
+		})
+	}
+}
+
+// Builds a preview request with the given form fields and archive file (if
+// any)
+func newPreviewRequest(t *testing.T, fields map[string]string, archive string) *http.Request {
+	var body bytes.Buffer
+
+	writer := multipart.NewWriter(&body)
+
+	for name, value := range fields {
+		writer.WriteField(name, value)
+	}
+
+	if archive != "" {
+		buf, err := ioutil.ReadFile(archive)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		part, err := writer.CreateFormFile("archive", "tweet.js")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		part.Write(buf)
+	}
+
+	writer.Close()
+
+	r := httptest.NewRequest(http.MethodPost, "/preview", &body)
+	r.Header.Set("Content-Type", writer.FormDataContentType())
+
+	return r
+}
+
+func TestPreviewHandler(t *testing.T) {
+	const archive = "../lib/sample_archive.js"
+
+	var inputs = []struct {
+		name    string
+		fields  map[string]string
+		archive string
+		status  int
+		count   int
+	}{
+		{"match", map[string]string{"rule": "likes >= 1"}, archive, http.StatusOK, 2},
+		{"no match", map[string]string{"rule": "likes > 100"}, archive, http.StatusOK, 0},
+		{"now", map[string]string{"rule": "age < 1d", "now": "2020-07-02T12:00:00Z"}, archive, http.StatusOK, 1},
+		{"timezone", map[string]string{"rule": "created == 2020-07-01", "timezone": "America/Los_Angeles"}, archive, http.StatusOK, 0},
+		{"invalid rule", map[string]string{"rule": "likes >"}, archive, http.StatusUnprocessableEntity, 0},
+		{"invalid regexp", map[string]string{"rule": `text ~ "("`}, archive, http.StatusUnprocessableEntity, 0},
+		{"invalid timezone", map[string]string{"rule": "likes >= 1", "timezone": "Mars/Olympus"}, archive, http.StatusBadRequest, 0},
+		{"invalid now", map[string]string{"rule": "likes >= 1", "now": "tomorrow"}, archive, http.StatusBadRequest, 0},
+		{"missing archive", map[string]string{"rule": "likes >= 1"}, "", http.StatusBadRequest, 0},
+		{"invalid archive", map[string]string{"rule": "likes >= 1"}, "../lib/sample_archive_invalid.js", http.StatusBadRequest, 0},
+	}
+
+	for _, input := range inputs {
+		t.Run(input.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			previewHandler(w, newPreviewRequest(t, input.fields, input.archive))
+
+			if w.Code != input.status {
+				t.Fatalf("Expected status %d, got %d: %s", input.status, w.Code, w.Body)
+			}
+
+			if w.Code != http.StatusOK {
+				return
+			}
+
+			var resp struct {
+				Count  int            `json:"count"`
+				Tweets []previewTweet `json:"tweets"`
+			}
+
+			err := json.Unmarshal(w.Body.Bytes(), &resp)
+			if err != nil {
+				t.Fatalf("Invalid response: %s", err)
+			}
+
+			if resp.Count != input.count || len(resp.Tweets) != input.count {
+				t.Errorf("Expected %d tweets, got: %s", input.count, w.Body)
+			}
+
+			// Tweets are always returned as an array
+			if input.count == 0 && !strings.Contains(w.Body.String(), `"tweets":[]`) {
+				t.Errorf("Expected an empty array of tweets: %s", w.Body)
+			}
+		})
+	}
+
+	// A non-multipart body is rejected
+	w := httptest.NewRecorder()
+	previewHandler(w, httptest.NewRequest(http.MethodPost, "/preview", strings.NewReader("rule=likes")))
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got %d", w.Code)
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// Persists all jobs to a JSON file, so that they survive restarts.
+//
+// Note that the file contains the Twitter API keys of each job, so it is only
+// readable by the current user.
+type jobStore struct {
+	path string
+}
+
+// Contents of the store file
+type storeFile struct {
+	Jobs []*jobConfig `json:"jobs"`
+}
+
+func newJobStore(path string) *jobStore {
+	return &jobStore{path: path}
+}
+
+// Loads all jobs from the store. A missing store is treated as empty.
+func (store *jobStore) load() ([]*jobConfig, error) {
+	buf, err := ioutil.ReadFile(store.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var contents storeFile
+
+	err = json.Unmarshal(buf, &contents)
+	if err != nil {
+		return nil, err
+	}
+
+	return contents.Jobs, nil
+}
+
+// Replaces the contents of the store with the given jobs
+func (store *jobStore) save(jobs []*jobConfig) error {
+	buf, err := json.MarshalIndent(&storeFile{Jobs: jobs}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file first, so that a crash mid-write does not
+	// corrupt the store
+	f, err := ioutil.TempFile(filepath.Dir(store.path), filepath.Base(store.path)+".*")
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(buf)
+	if err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+
+	err = f.Close()
+	if err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+
+	return os.Rename(f.Name(), store.path)
+}